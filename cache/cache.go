@@ -0,0 +1,641 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	casDir     = "cas"
+	actionsDir = "actions"
+	dirEnv     = "COGS_CACHE_DIR"
+)
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Cache stores task outputs on disk. File contents live in a content
+// addressable store keyed by their sha256 digest, and action entries map a
+// key computed from a task's inputs to the output files it produced.
+type Cache struct {
+	dir    string
+	remote *Remote
+}
+
+type File struct {
+	Path   string      `json:"path"`
+	Digest string      `json:"digest,omitempty"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	Link   string      `json:"link,omitempty"`
+}
+
+type Entry struct {
+	Key      string    `json:"key"`
+	Task     string    `json:"task"`
+	Created  time.Time `json:"created"`
+	Outputs  []string  `json:"outputs"`
+	Files    []File    `json:"files"`
+	LastUsed time.Time `json:"-"`
+}
+
+// Size is the total size of the files in the entry.
+func (e Entry) Size() int64 {
+	var size int64
+
+	for _, file := range e.Files {
+		size += file.Size
+	}
+
+	return size
+}
+
+// validate guards against entries from a remote cache pointing outside the
+// working directory or the store. Files must be inside the outputs of the
+// entry, and symbolic links must point to files inside the working directory.
+func (e Entry) validate() error {
+	for _, output := range e.Outputs {
+		if !isRelativePath(output) {
+			return errors.Errorf("invalid path %s", output)
+		}
+	}
+
+	for _, file := range e.Files {
+		if file.Digest != "" && !digestPattern.MatchString(file.Digest) {
+			return errors.Errorf("invalid digest %s", file.Digest)
+		}
+
+		if !isRelativePath(file.Path) || !e.inOutputs(file.Path) {
+			return errors.Errorf("invalid path %s", file.Path)
+		}
+
+		if file.Link != "" && (path.IsAbs(file.Link) || !isRelativePath(path.Join(path.Dir(file.Path), file.Link))) {
+			return errors.Errorf("invalid link %s -> %s", file.Path, file.Link)
+		}
+	}
+
+	return nil
+}
+
+func (e Entry) inOutputs(file string) bool {
+	file = path.Clean(file)
+
+	for _, output := range e.Outputs {
+		output = path.Clean(output)
+
+		if file == output || strings.HasPrefix(file, output+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isRelativePath(p string) bool {
+	cleaned := path.Clean(p)
+
+	return p != "" && !path.IsAbs(cleaned) && cleaned != "." && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
+
+type Stats struct {
+	Entries int
+	Blobs   int
+	Bytes   int64
+}
+
+type PruneResult struct {
+	Entries int
+	Blobs   int
+	Bytes   int64
+}
+
+// DefaultDir is the cache directory used unless COGS_CACHE_DIR is set.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(dirEnv); dir != "" {
+		return dir, nil
+	}
+
+	dir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", errors.Wrap(err, "unable to determine cache directory")
+	}
+
+	return filepath.Join(dir, "cogs"), nil
+}
+
+func Open(dir string) (*Cache, error) {
+	for _, sub := range []string{casDir, actionsDir} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0755)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create cache directory")
+		}
+	}
+
+	return &Cache{dir: dir}, nil
+}
+
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// UseRemote shares entries with a remote cache. Entries missing locally are
+// looked up remotely, and new entries are uploaded unless the remote is read
+// only. Remote failures never fail the local operation.
+func (c *Cache) UseRemote(remote *Remote) {
+	c.remote = remote
+}
+
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, actionsDir, key+".json")
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.dir, casDir, digest[:2], digest)
+}
+
+// Get returns the entry stored under key, or nil if there is none.
+func (c *Cache) Get(ctx context.Context, key string) (*Entry, error) {
+	entry, err := c.readEntry(c.entryPath(key))
+
+	if !os.IsNotExist(errors.Cause(err)) {
+		return entry, err
+	}
+
+	if c.remote == nil || !c.remote.available() {
+		return nil, nil
+	}
+
+	entry, err = c.remote.fetch(ctx, c, key)
+
+	// Unreachable remotes were already reported when they got disabled.
+	if err != nil && c.remote.available() {
+		log.Println("Unable to read from remote cache", err)
+	}
+
+	if err != nil {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+func (c *Cache) readEntry(file string) (*Entry, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read cache entry")
+	}
+
+	info, err := os.Stat(file)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read cache entry")
+	}
+
+	var entry Entry
+
+	err = json.Unmarshal(content, &entry)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cache entry %s", filepath.Base(file))
+	}
+
+	entry.LastUsed = info.ModTime()
+
+	return &entry, nil
+}
+
+// Put stores the outputs found below root and records them under key.
+// Outputs are files or directories relative to root.
+func (c *Cache) Put(ctx context.Context, key, task, root string, outputs []string) (*Entry, error) {
+	entry := &Entry{
+		Key:     key,
+		Task:    task,
+		Created: time.Now().UTC(),
+		Outputs: outputs,
+		Files:   []File{},
+	}
+
+	for _, output := range outputs {
+		files, err := c.storeOutput(root, output)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Files = append(entry.Files, files...)
+	}
+
+	err := c.writeEntry(entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.remote != nil && !c.remote.readOnly && c.remote.available() {
+		err = c.remote.upload(ctx, c, entry)
+
+		if err != nil && c.remote.available() {
+			log.Println("Unable to upload to remote cache", err)
+		}
+	}
+
+	return entry, nil
+}
+
+func (c *Cache) storeOutput(root, output string) ([]File, error) {
+	var files []File
+
+	start := filepath.Join(root, filepath.FromSlash(output))
+
+	_, err := os.Lstat(start)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "output %s was not produced", output)
+	}
+
+	err = filepath.Walk(start, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, file)
+
+		if err != nil {
+			return err
+		}
+
+		stored := File{Path: filepath.ToSlash(rel), Mode: info.Mode()}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			stored.Link, err = os.Readlink(file)
+		} else if info.Mode().IsRegular() {
+			stored.Digest, stored.Size, err = c.storeFile(file)
+		} else {
+			return errors.Errorf("unsupported file type: %s", rel)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		files = append(files, stored)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to store output %s", output)
+	}
+
+	return files, nil
+}
+
+func (c *Cache) storeFile(file string) (string, int64, error) {
+	source, err := os.Open(file)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer source.Close()
+
+	return c.WriteBlob(source)
+}
+
+// WriteBlob adds content to the content addressable store and returns its
+// digest and size.
+func (c *Cache) WriteBlob(reader io.Reader) (string, int64, error) {
+	temp, err := ioutil.TempFile(filepath.Join(c.dir, casDir), ".blob-")
+
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unable to create blob")
+	}
+
+	defer os.Remove(temp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, hash), reader)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unable to write blob")
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	blob := c.blobPath(digest)
+
+	if c.HasBlob(digest) {
+		return digest, size, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(blob), 0755)
+
+	if err == nil {
+		err = os.Rename(temp.Name(), blob)
+	}
+
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unable to store blob")
+	}
+
+	return digest, size, nil
+}
+
+func (c *Cache) HasBlob(digest string) bool {
+	_, err := os.Stat(c.blobPath(digest))
+
+	return err == nil
+}
+
+func (c *Cache) OpenBlob(digest string) (*os.File, error) {
+	return os.Open(c.blobPath(digest))
+}
+
+// WriteEntry records an entry whose files are already in the store.
+func (c *Cache) WriteEntry(entry *Entry) error {
+	for _, file := range entry.Files {
+		if file.Digest != "" && !c.HasBlob(file.Digest) {
+			return errors.Errorf("missing blob %s for %s", file.Digest, file.Path)
+		}
+	}
+
+	return c.writeEntry(entry)
+}
+
+func (c *Cache) writeEntry(entry *Entry) error {
+	content, err := json.MarshalIndent(entry, "", "  ")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to encode cache entry")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Join(c.dir, actionsDir), ".entry-")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write cache entry")
+	}
+
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(content)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), c.entryPath(entry.Key))
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write cache entry")
+	}
+
+	return nil
+}
+
+// Restore replaces the outputs of an entry below root with the cached files.
+func (c *Cache) Restore(entry *Entry, root string) error {
+	for _, file := range entry.Files {
+		if file.Digest != "" && !c.HasBlob(file.Digest) {
+			return errors.Errorf("missing blob %s for %s", file.Digest, file.Path)
+		}
+	}
+
+	for _, output := range entry.Outputs {
+		err := checkParents(root, output)
+
+		if err == nil {
+			err = os.RemoveAll(filepath.Join(root, filepath.FromSlash(output)))
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to remove output %s", output)
+		}
+	}
+
+	for _, file := range entry.Files {
+		err := checkParents(root, file.Path)
+
+		if err == nil {
+			err = c.restoreFile(file, filepath.Join(root, filepath.FromSlash(file.Path)))
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to restore %s", file.Path)
+		}
+	}
+
+	now := time.Now()
+
+	return os.Chtimes(c.entryPath(entry.Key), now, now)
+}
+
+// checkParents returns an error if a directory between root and a file is a
+// symbolic link, writing the file would then follow it, possibly out of root.
+func checkParents(root, file string) error {
+	dir := root
+
+	for _, part := range strings.Split(path.Dir(path.Clean(file)), "/") {
+		if part == "." {
+			continue
+		}
+
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("%s is a symbolic link", dir)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) restoreFile(file File, target string) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	// Outputs were removed, anything found here was restored from the same
+	// entry already.
+	if _, err = os.Lstat(target); err == nil {
+		return errors.Errorf("%s is restored twice", file.Path)
+	}
+
+	if file.Link != "" {
+		return os.Symlink(file.Link, target)
+	}
+
+	blob, err := c.OpenBlob(file.Digest)
+
+	if err != nil {
+		return err
+	}
+
+	defer blob.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode.Perm())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, blob)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(target, file.Mode.Perm())
+}
+
+// Entries returns all entries, most recently used first.
+func (c *Cache) Entries() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, actionsDir, "*.json"))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list cache entries")
+	}
+
+	entries := make([]Entry, 0, len(files))
+
+	for _, file := range files {
+		entry, err := c.readEntry(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Prune removes entries that were not used since the given time, followed by
+// all blobs no remaining entry refers to.
+func (c *Cache) Prune(unusedSince time.Time) (PruneResult, error) {
+	var result PruneResult
+
+	entries, err := c.Entries()
+
+	if err != nil {
+		return result, err
+	}
+
+	referenced := map[string]bool{}
+
+	for _, entry := range entries {
+		if entry.LastUsed.Before(unusedSince) {
+			err = os.Remove(c.entryPath(entry.Key))
+
+			if err != nil {
+				return result, errors.Wrap(err, "unable to remove cache entry")
+			}
+
+			result.Entries++
+			continue
+		}
+
+		for _, file := range entry.Files {
+			referenced[file.Digest] = true
+		}
+	}
+
+	err = c.walkBlobs(func(blob string, info os.FileInfo) error {
+		if referenced[info.Name()] {
+			return nil
+		}
+
+		result.Blobs++
+		result.Bytes += info.Size()
+
+		return os.Remove(blob)
+	})
+
+	if err != nil {
+		return result, errors.Wrap(err, "unable to remove blobs")
+	}
+
+	return result, nil
+}
+
+func (c *Cache) Stats() (Stats, error) {
+	var stats Stats
+
+	entries, err := filepath.Glob(filepath.Join(c.dir, actionsDir, "*.json"))
+
+	if err != nil {
+		return stats, errors.Wrap(err, "unable to list cache entries")
+	}
+
+	stats.Entries = len(entries)
+
+	err = c.walkBlobs(func(_ string, info os.FileInfo) error {
+		stats.Blobs++
+		stats.Bytes += info.Size()
+
+		return nil
+	})
+
+	if err != nil {
+		return stats, errors.Wrap(err, "unable to list blobs")
+	}
+
+	return stats, nil
+}
+
+func (c *Cache) walkBlobs(visit func(blob string, info os.FileInfo) error) error {
+	return filepath.Walk(filepath.Join(c.dir, casDir), func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		return visit(file, info)
+	})
+}
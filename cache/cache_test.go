@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.Nil(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+}
+
+func readFile(t *testing.T, file string) string {
+	content, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+
+	return string(content)
+}
+
+func TestKey(t *testing.T) {
+	root, err := ioutil.TempDir("", "cogs-key")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{"main.go": "package main", "bin/app": "binary"})
+
+	inputs := Inputs{Task: "build", Executor: "shell", Script: []string{"go build -o bin/app"}, Sources: []string{"**"}, Outputs: []string{"bin"}}
+
+	key, err := Key(root, inputs)
+	require.Nil(t, err)
+
+	t.Run("Should be stable", func(t *testing.T) {
+		again, err := Key(root, inputs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, key, again)
+	})
+
+	t.Run("Should ignore outputs", func(t *testing.T) {
+		writeFiles(t, root, map[string]string{"bin/app": "rebuilt"})
+
+		again, err := Key(root, inputs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, key, again)
+	})
+
+	t.Run("Should change with sources", func(t *testing.T) {
+		writeFiles(t, root, map[string]string{"main.go": "package main // changed"})
+		defer writeFiles(t, root, map[string]string{"main.go": "package main"})
+
+		changed, err := Key(root, inputs)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, changed)
+	})
+
+	t.Run("Should change with env and script", func(t *testing.T) {
+		withEnv := inputs
+		withEnv.Env = map[string]string{"CGO_ENABLED": "0"}
+
+		changed, err := Key(root, withEnv)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, changed)
+
+		withScript := inputs
+		withScript.Script = []string{"go build -race -o bin/app"}
+
+		changed, err = Key(root, withScript)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, changed)
+	})
+
+	t.Run("Should change with after_script and container options", func(t *testing.T) {
+		withAfterScript := inputs
+		withAfterScript.AfterScript = []string{"strip bin/app"}
+
+		changed, err := Key(root, withAfterScript)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, changed)
+
+		withContainer := inputs
+		withContainer.Container = &executor.ContainerOptions{Platform: "linux/arm64"}
+
+		changed, err = Key(root, withContainer)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, changed)
+
+		withContainer.Container = &executor.ContainerOptions{Volumes: []executor.Volume{{Source: "/data", Target: "/data"}}}
+
+		again, err := Key(root, withContainer)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, changed, again)
+	})
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-cache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	root, err := ioutil.TempDir("", "cogs-cache-root")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	c, err := Open(dir)
+	require.Nil(t, err)
+
+	writeFiles(t, root, map[string]string{"bin/app": "binary", "bin/lib/helper": "helper", "report.txt": "ok"})
+	require.Nil(t, os.Symlink("app", filepath.Join(root, "bin", "latest")))
+
+	t.Run("Should store and restore outputs", func(t *testing.T) {
+		entry, err := c.Put(context.Background(), "key1", "build", root, []string{"bin", "report.txt"})
+
+		assert.Nil(t, err)
+		assert.Len(t, entry.Files, 4)
+		assert.Equal(t, int64(len("binary")+len("helper")+len("ok")), entry.Size())
+
+		require.Nil(t, os.RemoveAll(filepath.Join(root, "bin")))
+		writeFiles(t, root, map[string]string{"report.txt": "stale", "bin/stale": "stale"})
+
+		found, err := c.Get(context.Background(), "key1")
+		require.Nil(t, err)
+		require.NotNil(t, found)
+
+		assert.Nil(t, c.Restore(found, root))
+		assert.Equal(t, "binary", readFile(t, filepath.Join(root, "bin", "app")))
+		assert.Equal(t, "helper", readFile(t, filepath.Join(root, "bin", "lib", "helper")))
+		assert.Equal(t, "ok", readFile(t, filepath.Join(root, "report.txt")))
+		assert.NoFileExists(t, filepath.Join(root, "bin", "stale"))
+
+		link, err := os.Readlink(filepath.Join(root, "bin", "latest"))
+		assert.Nil(t, err)
+		assert.Equal(t, "app", link)
+	})
+
+	t.Run("Should return nil for unknown keys", func(t *testing.T) {
+		entry, err := c.Get(context.Background(), "unknown")
+
+		assert.Nil(t, err)
+		assert.Nil(t, entry)
+	})
+
+	t.Run("Should return error if output is missing", func(t *testing.T) {
+		_, err := c.Put(context.Background(), "key2", "build", root, []string{"missing"})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Should not write through restored symbolic links", func(t *testing.T) {
+		outside, err := ioutil.TempDir("", "cogs-cache-outside")
+		require.Nil(t, err)
+		defer os.RemoveAll(outside)
+
+		found, err := c.Get(context.Background(), "key1")
+		require.Nil(t, err)
+		require.NotNil(t, found)
+
+		digest := ""
+
+		for _, file := range found.Files {
+			if file.Path == "bin/app" {
+				digest = file.Digest
+			}
+		}
+
+		evil := &Entry{Key: "evil", Outputs: []string{"evil"}, Files: []File{
+			{Path: "evil/dir", Link: outside},
+			{Path: "evil/dir/pwned", Digest: digest, Size: int64(len("binary")), Mode: 0644},
+		}}
+
+		assert.NotNil(t, c.Restore(evil, root))
+		assert.NoFileExists(t, filepath.Join(outside, "pwned"))
+	})
+
+	t.Run("Should deduplicate contents", func(t *testing.T) {
+		writeFiles(t, root, map[string]string{"copy/app": "binary"})
+
+		_, err := c.Put(context.Background(), "key3", "copy", root, []string{"copy"})
+		require.Nil(t, err)
+
+		stats, err := c.Stats()
+
+		assert.Nil(t, err)
+		assert.Equal(t, Stats{Entries: 2, Blobs: 3, Bytes: int64(len("binary") + len("helper") + len("ok"))}, stats)
+	})
+
+	t.Run("Should prune unused entries and blobs", func(t *testing.T) {
+		old := time.Now().Add(-48 * time.Hour)
+		require.Nil(t, os.Chtimes(c.entryPath("key1"), old, old))
+
+		entries, err := c.Entries()
+		require.Nil(t, err)
+		assert.Equal(t, "key3", entries[0].Key)
+		assert.Equal(t, "key1", entries[1].Key)
+
+		result, err := c.Prune(time.Now().Add(-24 * time.Hour))
+
+		assert.Nil(t, err)
+		assert.Equal(t, PruneResult{Entries: 1, Blobs: 2, Bytes: int64(len("helper") + len("ok"))}, result)
+
+		stats, err := c.Stats()
+
+		assert.Nil(t, err)
+		assert.Equal(t, Stats{Entries: 1, Blobs: 1, Bytes: int64(len("binary"))}, stats)
+	})
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// keyVersion changes whenever the way keys are computed changes, so that old
+// entries are no longer matched.
+const keyVersion = "2"
+
+// Inputs describes everything that influences the outputs of a task.
+type Inputs struct {
+	Task         string
+	Executor     string
+	Image        string
+	ImageDigest  string
+	Shell        string
+	ShellArgs    []string
+	Env          map[string]string
+	BeforeScript []string
+	Script       []string
+	AfterScript  []string
+	Container    *executor.ContainerOptions
+	Sources      []string
+	Outputs      []string
+}
+
+// Key hashes the inputs of a task together with the contents of the source
+// files they match below root. Files inside the outputs are not sources.
+func Key(root string, inputs Inputs) (string, error) {
+	hash := sha256.New()
+
+	description, err := json.Marshal(inputs)
+
+	if err != nil {
+		return "", errors.Wrap(err, "unable to encode task inputs")
+	}
+
+	fmt.Fprintf(hash, "v%s\n%s\n", keyVersion, description)
+
+	files, err := utils.Glob(root, inputs.Sources)
+
+	if err != nil {
+		return "", errors.Wrap(err, "unable to find sources")
+	}
+
+	// Files cogs keeps per run, such as artifacts, are never sources.
+	for _, file := range files {
+		if isOutput(file, inputs.Outputs) || strings.HasPrefix(file, executor.StateDir+"/") {
+			continue
+		}
+
+		digest, err := hashFile(filepath.Join(root, filepath.FromSlash(file)))
+
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to hash source %s", file)
+		}
+
+		fmt.Fprintf(hash, "%s\x00%s\n", file, digest)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func isOutput(file string, outputs []string) bool {
+	for _, output := range outputs {
+		output = path.Clean(output)
+
+		if file == output || strings.HasPrefix(file, output+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, f)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const remoteTimeout = 5 * time.Minute
+
+// Remote is an HTTP cache in the layout used by Bazel and Gradle remote
+// caches: entries are stored under /ac/<key> and file contents under
+// /cas/<digest>, both read with GET and written with PUT. Credentials may be
+// given in the URL.
+//
+// Remote caches are optional. After the first failure to reach the server
+// the remote is disabled for the rest of the run and cogs continues with the
+// local cache only.
+type Remote struct {
+	url      string
+	client   *http.Client
+	readOnly bool
+	mutex    sync.Mutex
+	disabled bool
+}
+
+func NewRemote(url string, readOnly bool) *Remote {
+	return &Remote{
+		url:      strings.TrimSuffix(url, "/"),
+		client:   &http.Client{Timeout: remoteTimeout},
+		readOnly: readOnly,
+	}
+}
+
+func (r *Remote) available() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return !r.disabled
+}
+
+func (r *Remote) disable(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.disabled {
+		log.Println("Remote cache unavailable, continuing without it:", err)
+	}
+
+	r.disabled = true
+}
+
+func (r *Remote) do(ctx context.Context, method, path string, body io.Reader, size int64) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, r.url+path, body)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid remote cache request")
+	}
+
+	if body != nil {
+		request.ContentLength = size
+	}
+
+	response, err := r.client.Do(request)
+
+	if err != nil {
+		r.disable(err)
+		return nil, errors.Wrapf(err, "remote cache %s %s failed", method, path)
+	}
+
+	if response.StatusCode >= 500 {
+		response.Body.Close()
+		err = errors.Errorf("remote cache %s %s failed: %s", method, path, response.Status)
+		r.disable(err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (r *Remote) get(ctx context.Context, path string, w io.Writer) (bool, error) {
+	response, err := r.do(ctx, http.MethodGet, path, nil, 0)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return false, errors.Errorf("remote cache GET %s failed: %s", path, response.Status)
+	}
+
+	_, err = io.Copy(w, response.Body)
+
+	if err != nil {
+		return false, errors.Wrapf(err, "remote cache GET %s failed", path)
+	}
+
+	return true, nil
+}
+
+func (r *Remote) put(ctx context.Context, path string, body io.Reader, size int64) error {
+	response, err := r.do(ctx, http.MethodPut, path, body, size)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.Errorf("remote cache PUT %s failed: %s", path, response.Status)
+	}
+
+	return nil
+}
+
+func (r *Remote) has(ctx context.Context, path string) bool {
+	response, err := r.do(ctx, http.MethodHead, path, nil, 0)
+
+	if err != nil {
+		return false
+	}
+
+	response.Body.Close()
+
+	return response.StatusCode == http.StatusOK
+}
+
+// fetch downloads an entry and the file contents it refers to into the local
+// cache. It returns nil if the remote doesn't know the key.
+func (r *Remote) fetch(ctx context.Context, c *Cache, key string) (*Entry, error) {
+	var content bytes.Buffer
+
+	found, err := r.get(ctx, "/ac/"+key, &content)
+
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var entry Entry
+
+	err = json.Unmarshal(content.Bytes(), &entry)
+
+	if err == nil {
+		err = entry.validate()
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid remote cache entry %s", key)
+	}
+
+	for _, file := range entry.Files {
+		if file.Digest == "" || c.HasBlob(file.Digest) {
+			continue
+		}
+
+		err = r.fetchBlob(ctx, c, file.Digest)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry.Key = key
+	err = c.WriteEntry(&entry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.readEntry(c.entryPath(key))
+}
+
+func (r *Remote) fetchBlob(ctx context.Context, c *Cache, digest string) error {
+	reader, writer := io.Pipe()
+	result := make(chan error, 1)
+
+	go func() {
+		stored, _, err := c.WriteBlob(reader)
+
+		if err == nil && stored != digest {
+			err = errors.Errorf("remote cache returned corrupt blob %s", digest)
+		}
+
+		reader.CloseWithError(err)
+		result <- err
+	}()
+
+	found, err := r.get(ctx, "/cas/"+digest, writer)
+
+	if err == nil && !found {
+		err = errors.Errorf("remote cache is missing blob %s", digest)
+	}
+
+	writer.CloseWithError(err)
+
+	if storeErr := <-result; err == nil {
+		err = storeErr
+	}
+
+	return err
+}
+
+// upload sends file contents the remote doesn't have yet, followed by the
+// entry itself.
+func (r *Remote) upload(ctx context.Context, c *Cache, entry *Entry) error {
+	uploaded := map[string]bool{}
+
+	for _, file := range entry.Files {
+		if file.Digest == "" || uploaded[file.Digest] {
+			continue
+		}
+
+		uploaded[file.Digest] = true
+
+		if r.has(ctx, "/cas/"+file.Digest) {
+			continue
+		}
+
+		err := r.uploadBlob(ctx, c, file)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := json.Marshal(entry)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to encode cache entry")
+	}
+
+	return r.put(ctx, "/ac/"+entry.Key, bytes.NewReader(content), int64(len(content)))
+}
+
+func (r *Remote) uploadBlob(ctx context.Context, c *Cache, file File) error {
+	blob, err := c.OpenBlob(file.Digest)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to read blob %s", file.Digest)
+	}
+
+	defer blob.Close()
+
+	return r.put(ctx, "/cas/"+file.Digest, blob, file.Size)
+}
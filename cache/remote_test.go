@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeRemote is an in-memory HTTP cache.
+type fakeRemote struct {
+	mutex    sync.Mutex
+	contents map[string][]byte
+	puts     int
+}
+
+func (f *fakeRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		content, found := f.contents[r.URL.Path]
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		content, _ := ioutil.ReadAll(r.Body)
+		f.contents[r.URL.Path] = content
+		f.puts++
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func openTestCache(t *testing.T, remote *Remote) *Cache {
+	dir, err := ioutil.TempDir("", "cogs-cache")
+	require.Nil(t, err)
+
+	c, err := Open(dir)
+	require.Nil(t, err)
+
+	c.UseRemote(remote)
+
+	return c
+}
+
+func TestRemote(t *testing.T) {
+	ctx := context.Background()
+	server := &fakeRemote{contents: map[string][]byte{}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	root, err := ioutil.TempDir("", "cogs-remote-root")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{"bin/app": "binary", "bin/copy": "binary"})
+
+	t.Run("Should upload entries and contents", func(t *testing.T) {
+		c := openTestCache(t, NewRemote(httpServer.URL+"/", false))
+		defer os.RemoveAll(c.Dir())
+
+		entry, err := c.Put(ctx, "key1", "build", root, []string{"bin"})
+		require.Nil(t, err)
+
+		assert.Contains(t, server.contents, "/ac/key1")
+		assert.Contains(t, server.contents, "/cas/"+entry.Files[0].Digest)
+		assert.Equal(t, 2, server.puts)
+	})
+
+	t.Run("Should download entries missing locally", func(t *testing.T) {
+		c := openTestCache(t, NewRemote(httpServer.URL, false))
+		defer os.RemoveAll(c.Dir())
+
+		entry, err := c.Get(ctx, "key1")
+		require.Nil(t, err)
+		require.NotNil(t, entry)
+
+		target, err := ioutil.TempDir("", "cogs-remote-target")
+		require.Nil(t, err)
+		defer os.RemoveAll(target)
+
+		assert.Nil(t, c.Restore(entry, target))
+		assert.Equal(t, "binary", readFile(t, filepath.Join(target, "bin", "app")))
+
+		missing, err := c.Get(ctx, "key2")
+
+		assert.Nil(t, err)
+		assert.Nil(t, missing)
+	})
+
+	t.Run("Should not upload to a read-only remote", func(t *testing.T) {
+		c := openTestCache(t, NewRemote(httpServer.URL, true))
+		defer os.RemoveAll(c.Dir())
+
+		_, err := c.Put(ctx, "key3", "build", root, []string{"bin"})
+
+		assert.Nil(t, err)
+		assert.NotContains(t, server.contents, "/ac/key3")
+	})
+
+	t.Run("Should reject entries pointing outside the working directory", func(t *testing.T) {
+		server.contents["/ac/evil"] = []byte(`{"key": "evil", "outputs": ["../etc"], "files": []}`)
+
+		c := openTestCache(t, NewRemote(httpServer.URL, false))
+		defer os.RemoveAll(c.Dir())
+
+		entry, err := c.Get(ctx, "evil")
+
+		assert.Nil(t, err)
+		assert.Nil(t, entry)
+	})
+
+	t.Run("Should reject entries with links pointing outside the working directory", func(t *testing.T) {
+		server.contents["/ac/absolute"] = []byte(`{"key": "absolute", "outputs": ["bin"], "files": [{"path": "bin/etc", "link": "/etc"}]}`)
+		server.contents["/ac/escaping"] = []byte(`{"key": "escaping", "outputs": ["bin"], "files": [{"path": "bin/etc", "link": "../../etc"}]}`)
+		server.contents["/ac/foreign"] = []byte(`{"key": "foreign", "outputs": ["bin"], "files": [{"path": "lib/app", "link": "app"}]}`)
+
+		c := openTestCache(t, NewRemote(httpServer.URL, false))
+		defer os.RemoveAll(c.Dir())
+
+		for _, key := range []string{"absolute", "escaping", "foreign"} {
+			entry, err := c.Get(ctx, key)
+
+			assert.Nil(t, err)
+			assert.Nil(t, entry)
+		}
+	})
+
+	t.Run("Should keep working when remote is unavailable", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.NotFoundHandler())
+		unavailable.Close()
+
+		remote := NewRemote(unavailable.URL, false)
+		c := openTestCache(t, remote)
+		defer os.RemoveAll(c.Dir())
+
+		entry, err := c.Get(ctx, "key1")
+
+		assert.Nil(t, err)
+		assert.Nil(t, entry)
+		assert.False(t, remote.available())
+
+		_, err = c.Put(ctx, "key1", "build", root, []string{"bin"})
+		assert.Nil(t, err)
+
+		entry, err = c.Get(ctx, "key1")
+
+		assert.Nil(t, err)
+		assert.NotNil(t, entry)
+	})
+}
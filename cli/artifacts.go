@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// artifactStore returns the directory holding the artifacts of a task during
+// the current run.
+func artifactStore(cwd, task string) string {
+	return filepath.Join(cwd, artifactDir(task))
+}
+
+// artifactDir is the artifact store of a task relative to the working
+// directory.
+func artifactDir(task string) string {
+	return filepath.Join(executor.StateDir, "artifacts", task)
+}
+
+// resetArtifacts removes artifacts left over from a previous run.
+func resetArtifacts(cwd string) error {
+	err := os.RemoveAll(filepath.Join(cwd, executor.StateDir, "artifacts"))
+
+	if err != nil {
+		return errors.Wrap(err, "unable to remove previous artifacts")
+	}
+
+	return nil
+}
+
+// collectArtifacts copies the artifacts of a task out of its environment into
+// the artifact store. A nil executor collects from the working directory.
+func collectArtifacts(ctx context.Context, e executor.Executor, t cogsfile.Task, cwd string) error {
+	if len(t.Artifacts) == 0 {
+		return nil
+	}
+
+	store := artifactStore(cwd, t.Name)
+
+	err := os.RemoveAll(store)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to clear artifact store")
+	}
+
+	for _, artifact := range t.Artifacts {
+		err = executor.CopyArtifact(ctx, e, cwd, artifact, store)
+
+		if err != nil {
+			return errors.Wrap(err, "unable to collect artifacts")
+		}
+	}
+
+	log.Printf("Collected %d artifacts of %s\n", len(t.Artifacts), t.Name)
+
+	return nil
+}
+
+// installArtifacts copies the artifacts a task needs from the store into the
+// working directory, which every executor sees as its workspace.
+func installArtifacts(t cogsfile.Task, cwd string) error {
+	for _, producer := range t.NeedsArtifacts {
+		store := artifactStore(cwd, producer)
+
+		_, err := os.Stat(store)
+
+		if err != nil {
+			return errors.Wrapf(err, "artifacts of %s are not available", producer)
+		}
+
+		err = utils.CopyTree(store, cwd)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to install artifacts of %s", producer)
+		}
+
+		log.Printf("Installed artifacts of %s\n", producer)
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	docker "github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+	"github.com/kinematic-ci/cogs/cache"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type CacheArgs struct {
+	Ls    *CacheLsArgs    `arg:"subcommand:ls" help:"List cached task outputs"`
+	Prune *CachePruneArgs `arg:"subcommand:prune" help:"Remove cached outputs that were not used recently"`
+	Stats *CacheStatsArgs `arg:"subcommand:stats" help:"Show cache size"`
+}
+
+type CacheLsArgs struct{}
+
+type CachePruneArgs struct {
+	OlderThan time.Duration `arg:"--older-than" help:"Remove entries not used for this long" default:"168h"`
+	All       bool          `arg:"--all" help:"Remove all entries"`
+}
+
+type CacheStatsArgs struct{}
+
+func Cache(args *CacheArgs) {
+	c := mustOpenCache()
+
+	switch {
+	case args.Prune != nil:
+		unusedSince := time.Now().Add(-args.Prune.OlderThan)
+
+		if args.Prune.All {
+			unusedSince = time.Now().Add(time.Hour)
+		}
+
+		result, err := c.Prune(unusedSince)
+
+		if err != nil {
+			log.Fatalln("Error pruning cache", err)
+		}
+
+		fmt.Printf("Removed %d entries and %d blobs, freed %s\n", result.Entries, result.Blobs, units.HumanSize(float64(result.Bytes)))
+	case args.Stats != nil:
+		stats, err := c.Stats()
+
+		if err != nil {
+			log.Fatalln("Error reading cache", err)
+		}
+
+		fmt.Printf("Directory: %s\nEntries:   %d\nBlobs:     %d\nSize:      %s\n", c.Dir(), stats.Entries, stats.Blobs, units.HumanSize(float64(stats.Bytes)))
+	default:
+		entries, err := c.Entries()
+
+		if err != nil {
+			log.Fatalln("Error reading cache", err)
+		}
+
+		fmt.Printf("%-14s %-20s %6s %10s  %s\n", "KEY", "TASK", "FILES", "SIZE", "LAST USED")
+
+		for _, entry := range entries {
+			fmt.Printf("%-14s %-20s %6d %10s  %s\n", entry.Key[:12], entry.Task, len(entry.Files), units.HumanSize(float64(entry.Size())), entry.LastUsed.Format(time.RFC3339))
+		}
+	}
+}
+
+func mustOpenCache() *cache.Cache {
+	dir, err := cache.DefaultDir()
+
+	if err != nil {
+		log.Fatalln("Error opening cache", err)
+	}
+
+	c, err := cache.Open(dir)
+
+	if err != nil {
+		log.Fatalln("Error opening cache", err)
+	}
+
+	return c
+}
+
+// openCache returns nil when the cache is unavailable, tasks then simply run.
+func openCache(opts options) *cache.Cache {
+	dir, err := cache.DefaultDir()
+
+	if err == nil {
+		var c *cache.Cache
+		c, err = cache.Open(dir)
+
+		if err == nil {
+			if opts.remoteCache != "" {
+				c.UseRemote(cache.NewRemote(opts.remoteCache, opts.remoteReadOnly))
+			}
+
+			return c
+		}
+	}
+
+	log.Println("Cache disabled:", err)
+
+	return nil
+}
+
+// runCachedTask restores the outputs of a task from the cache when its inputs
+// did not change, and stores them after a successful run otherwise. Only
+// tasks declaring both sources and outputs are cached, under their
+// fingerprint.
+func runCachedTask(ctx context.Context, t cogsfile.Task, fingerprint string, opts options, client *docker.Client, pool *executor.ContainerPool, taskCache *cache.Cache) error {
+	if taskCache == nil || len(t.Sources) == 0 || len(t.Outputs) == 0 || fingerprint == "" {
+		_, err := runTask(ctx, t, fingerprint, opts, client, pool)
+		return err
+	}
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		return errors.Wrap(err, "cannot determine cwd")
+	}
+
+	key := fingerprint
+
+	entry, err := taskCache.Get(ctx, key)
+
+	if err != nil {
+		log.Println("Unable to read cache", err)
+	}
+
+	if entry != nil {
+		err = taskCache.Restore(entry, cwd)
+
+		// Artifacts are stored along with the outputs, entries stored
+		// without them need the task to run.
+		if err == nil && len(t.Artifacts) > 0 {
+			_, err = os.Stat(artifactStore(cwd, t.Name))
+		}
+
+		if err == nil {
+			log.Printf("Restored outputs of %s from cache %s\n", t.Name, key[:12])
+			opts.events.Publish(events.Event{Type: events.TaskSkipped, Task: t.Name, Fingerprint: fingerprint, Reason: "cached"})
+			return nil
+		}
+
+		log.Println("Unable to restore outputs from cache", err)
+	}
+
+	// Outputs are stored under the fingerprint the task has once it ran,
+	// which is the key the next run looks them up with.
+	key, err = runTask(ctx, t, fingerprint, opts, client, pool)
+
+	if err != nil {
+		return err
+	}
+
+	cached := t.Outputs
+
+	// Published outputs and artifacts are stored along with the files, so
+	// dependents see the same values and files when the task is restored.
+	if hasOutputs(cwd, t.Name) {
+		cached = append(cached[:len(cached):len(cached)], filepath.ToSlash(outputFile(t.Name)))
+	}
+
+	if len(t.Artifacts) > 0 {
+		cached = append(cached[:len(cached):len(cached)], filepath.ToSlash(artifactDir(t.Name)))
+	}
+
+	_, err = taskCache.Put(ctx, key, t.Name, cwd, cached)
+
+	if err != nil {
+		log.Println("Unable to store outputs in cache", err)
+	} else {
+		log.Printf("Stored outputs of %s in cache %s\n", t.Name, key[:12])
+	}
+
+	return nil
+}
+
+func cacheKey(ctx context.Context, t cogsfile.Task, opts options, client *docker.Client, cwd string) (string, error) {
+	name := executorName(t, opts)
+
+	inputs := cache.Inputs{
+		Task:         t.Name,
+		Executor:     name,
+		Shell:        utils.StringOrDefault(t.Shell, defaultShell),
+		ShellArgs:    getShellArgs(t.ShellArgs),
+		Env:          t.EnvVars,
+		BeforeScript: t.BeforeScript.Lines(),
+		Script:       t.Script.Lines(),
+		AfterScript:  t.AfterScript.Lines(),
+		Sources:      t.Sources,
+		Outputs:      t.Outputs,
+	}
+
+	if name == executor.Docker || name == executor.Podman {
+		container, err := containerOptions(t)
+
+		if err != nil {
+			return "", err
+		}
+
+		inputs.Image = t.Image
+		inputs.Container = &container
+	}
+
+	switch name {
+	case executor.Docker:
+		inputs.ImageDigest = imageDigest(ctx, client, t.Image)
+	case executor.Podman:
+		inputs.ImageDigest = podmanImageDigest(ctx, t.Image)
+	}
+
+	return cache.Key(cwd, inputs)
+}
+
+// imageDigest identifies the local image, which is only known once the image
+// was pulled. The image name alone is used until then, runCachedTask stores
+// outputs under the key computed after the run.
+func imageDigest(ctx context.Context, client *docker.Client, image string) string {
+	inspect, _, err := client.ImageInspectWithRaw(ctx, image)
+
+	if err != nil {
+		return ""
+	}
+
+	return inspect.ID
+}
+
+func podmanImageDigest(ctx context.Context, image string) string {
+	client, err := executor.NewPodmanClient()
+
+	if err != nil {
+		return ""
+	}
+
+	defer client.Close()
+
+	return imageDigest(ctx, client, image)
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/dotenv"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// loadEnvFiles returns the task with the variables of its env files added to
+// env_vars. Later files override earlier ones and env_vars override them
+// all. Files may refer to variables of earlier files and of the host.
+func loadEnvFiles(cwd string, t cogsfile.Task) (cogsfile.Task, error) {
+	if len(t.EnvFile) == 0 {
+		return t, nil
+	}
+
+	env := map[string]string{}
+
+	lookup := func(name string) (string, bool) {
+		if value, found := env[name]; found {
+			return value, true
+		}
+
+		return os.LookupEnv(name)
+	}
+
+	for _, file := range t.EnvFile {
+		path := utils.ExpandHome(file)
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cwd, path)
+		}
+
+		vars, err := dotenv.Read(path, lookup)
+
+		if err != nil {
+			return t, errors.Wrapf(err, "unable to read env file %s", file)
+		}
+
+		for name, value := range vars {
+			env[name] = value
+		}
+	}
+
+	for name, value := range t.EnvVars {
+		env[name] = value
+	}
+
+	t.EnvVars = env
+
+	return t, nil
+}
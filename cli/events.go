@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// subscribeEvents writes the events of the bus in the given format. Without a
+// format no events are written. The returned function closes the destination.
+func subscribeEvents(bus *events.Bus, format, destination string) (func(), error) {
+	if format == "" {
+		if destination != "" {
+			return nil, errors.New("--events-file requires --events")
+		}
+
+		return func() {}, nil
+	}
+
+	if format != "json" {
+		return nil, errors.Errorf("unsupported events format: %s", format)
+	}
+
+	// Log lines go to stderr, events need a destination of their own.
+	if destination == "" {
+		return nil, errors.New("--events requires --events-file")
+	}
+
+	w, err := openEventsDestination(destination)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bus.Subscribe(events.JSONHandler(w))
+
+	return func() {
+		err := w.Close()
+
+		if err != nil {
+			log.Println("Unable to close event stream", err)
+		}
+	}, nil
+}
+
+// openEventsDestination opens a file, or an inherited file descriptor given
+// as fd:N.
+func openEventsDestination(destination string) (io.WriteCloser, error) {
+	if strings.HasPrefix(destination, "fd:") {
+		fd, err := strconv.Atoi(strings.TrimPrefix(destination, "fd:"))
+
+		if err != nil || fd < 0 {
+			return nil, errors.Errorf("invalid file descriptor: %s", destination)
+		}
+
+		return os.NewFile(uintptr(fd), destination), nil
+	}
+
+	f, err := os.Create(destination)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create events file")
+	}
+
+	return f, nil
+}
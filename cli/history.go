@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/history"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// keptHistoryRuns is how many runs the history keeps. It outlives the logs
+// of runs, so that durations can be compared over a longer time.
+const keptHistoryRuns = 500
+
+type HistoryArgs struct {
+	Ls   *HistoryLsArgs   `arg:"subcommand:ls" help:"List recent runs"`
+	Show *HistoryShowArgs `arg:"subcommand:show" help:"Show the tasks and logs of a run"`
+	Task *HistoryTaskArgs `arg:"subcommand:task" help:"Compare the durations of a task across runs"`
+}
+
+type HistoryLsArgs struct {
+	Limit int `arg:"-n,--limit" default:"20" help:"How many runs to list"`
+}
+
+type HistoryShowArgs struct {
+	Run  string `arg:"positional" help:"ID of the run or a prefix of it, defaults to the last run"`
+	Logs bool   `arg:"--logs" help:"Show the logs of the tasks too"`
+}
+
+type HistoryTaskArgs struct {
+	Task  string `arg:"positional,required" help:"The task to compare"`
+	Limit int    `arg:"-n,--limit" default:"20" help:"How many runs to compare"`
+}
+
+func History(args *HistoryArgs) {
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		log.Fatalln("Cannot determine cwd", err)
+	}
+
+	store := history.NewStore(historyDir(cwd))
+
+	switch {
+	case args.Show != nil:
+		err = showRun(store, cwd, args.Show.Run, args.Show.Logs)
+	case args.Task != nil:
+		err = compareTask(store, args.Task.Task, args.Task.Limit)
+	default:
+		limit := 20
+
+		if args.Ls != nil {
+			limit = args.Ls.Limit
+		}
+
+		err = listRuns(store, limit)
+	}
+
+	if err != nil {
+		log.Fatalln("Error reading history", err)
+	}
+}
+
+func historyDir(cwd string) string {
+	return filepath.Join(cwd, executor.StateDir, "history")
+}
+
+// recordRun adds a run to the history. Failing to record it doesn't fail the
+// run.
+func recordRun(run *report.Run) {
+	if run.ID == "" {
+		return
+	}
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		log.Println("Unable to record run in history", err)
+		return
+	}
+
+	record := history.FromReport(run, utils.GitCommit(cwd))
+	record.Dirty = utils.GitDirty(cwd, executor.StateDir)
+
+	store := history.NewStore(historyDir(cwd))
+	err = store.Save(record)
+
+	if err == nil {
+		err = store.Prune(keptHistoryRuns)
+	}
+
+	if err != nil {
+		log.Println("Unable to record run in history", err)
+	}
+}
+
+func listRuns(store *history.Store, limit int) error {
+	runs, err := store.List()
+
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tSTARTED\tTARGET\tSTATUS\tDURATION\tCOMMIT")
+
+	for i, run := range runs {
+		if limit > 0 && i == limit {
+			break
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID, run.Started.Local().Format("2006-01-02 15:04:05"), run.Target, run.Status,
+			roundDuration(run.Duration()), shortCommit(run.Commit))
+	}
+
+	return table.Flush()
+}
+
+func showRun(store *history.Store, cwd, id string, logs bool) error {
+	var run *history.Run
+	var err error
+
+	if id == "" {
+		run, err = store.Last()
+
+		if err == nil && run == nil {
+			return errors.Errorf("no runs recorded")
+		}
+	} else {
+		run, err = store.Get(id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Run:      %s\nTarget:   %s\nStatus:   %s\nStarted:  %s\nDuration: %s\n",
+		run.ID, run.Target, run.Status, run.Started.Local().Format(time.RFC3339), roundDuration(run.Duration()))
+
+	if run.Commit != "" && run.Dirty {
+		fmt.Printf("Commit:   %s (with changes)\n", run.Commit)
+	} else if run.Commit != "" {
+		fmt.Printf("Commit:   %s\n", run.Commit)
+	}
+
+	if run.Error != "" {
+		fmt.Printf("Error:    %s\n", run.Error)
+	}
+
+	fmt.Println()
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TASK\tEXECUTOR\tSTATUS\tDURATION\tEXIT CODE\tFINGERPRINT")
+
+	for _, task := range run.Tasks {
+		status := task.Status
+
+		if task.Reason != "" {
+			status += " (" + task.Reason + ")"
+		}
+
+		exitCode := "-"
+
+		if task.ExitCode != nil {
+			exitCode = fmt.Sprint(*task.ExitCode)
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			task.Name, task.Executor, status, taskRunDuration(task), exitCode, shortCommit(task.Fingerprint))
+	}
+
+	err = table.Flush()
+
+	if err != nil || !logs {
+		return err
+	}
+
+	for _, task := range run.Tasks {
+		content, err := ioutil.ReadFile(filepath.Join(logDir(cwd, run.ID), task.Name+".log"))
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n==> %s <==\n%s", task.Name, content)
+	}
+
+	return nil
+}
+
+// compareTask lists the durations of a task in recent runs, each compared to
+// the run before it.
+func compareTask(store *history.Store, name string, limit int) error {
+	runs, err := store.List()
+
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		run  history.Run
+		task history.Task
+	}
+
+	var entries []entry
+
+	for _, run := range runs {
+		if task, found := run.Task(name); found {
+			entries = append(entries, entry{run: run, task: task})
+		}
+	}
+
+	if len(entries) == 0 {
+		return errors.Errorf("task %s not found in history", name)
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tSTARTED\tSTATUS\tDURATION\tCHANGE")
+
+	var total, fastest, slowest time.Duration
+	ran := 0
+
+	for i, e := range entries {
+		change := "-"
+
+		// Entries are the most recent first, the run before is the next one.
+		for _, previous := range entries[i+1:] {
+			if ranTask(e.task) && ranTask(previous.task) {
+				change = signedDuration(e.task.Duration - previous.task.Duration)
+				break
+			}
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			e.run.ID, e.run.Started.Local().Format("2006-01-02 15:04:05"), e.task.Status, taskRunDuration(e.task), change)
+
+		if ranTask(e.task) {
+			ran++
+			total += e.task.Duration
+
+			if fastest == 0 || e.task.Duration < fastest {
+				fastest = e.task.Duration
+			}
+
+			if e.task.Duration > slowest {
+				slowest = e.task.Duration
+			}
+		}
+	}
+
+	err = table.Flush()
+
+	if err != nil || ran == 0 {
+		return err
+	}
+
+	fmt.Printf("\nRan %d times: average %s, fastest %s, slowest %s\n",
+		ran, roundDuration(total/time.Duration(ran)), roundDuration(fastest), roundDuration(slowest))
+
+	return nil
+}
+
+// ranTask reports whether the task ran, rather than being skipped or not
+// reached.
+func ranTask(task history.Task) bool {
+	return task.Status == string(report.Passed) || task.Status == string(report.Failed)
+}
+
+func taskRunDuration(task history.Task) string {
+	if !ranTask(task) {
+		return "-"
+	}
+
+	return roundDuration(task.Duration)
+}
+
+func roundDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func signedDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + roundDuration(-d)
+	}
+
+	return "+" + roundDuration(d)
+}
+
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
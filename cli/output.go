@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/secrets"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	outputInterleaved = "interleaved"
+	outputGrouped     = "grouped"
+	outputQuiet       = "quiet"
+	keptLogRuns       = 50
+)
+
+var (
+	// consoleMutex keeps lines written to the console by different tasks
+	// from mixing.
+	consoleMutex sync.Mutex
+	taskColors   = []int{36, 33, 35, 32, 34, 31}
+)
+
+func validateOutputMode(mode string) error {
+	switch mode {
+	case outputInterleaved, outputGrouped, outputQuiet:
+		return nil
+	default:
+		return errors.Errorf("unsupported output mode: %s", mode)
+	}
+}
+
+// newRunID returns an identifier for a run. IDs of later runs sort after
+// those of earlier ones.
+func newRunID() string {
+	random := make([]byte, 3)
+	_, _ = rand.Read(random)
+
+	return time.Now().UTC().Format("20060102-150405.000") + "-" + hex.EncodeToString(random)
+}
+
+func logDir(cwd, runID string) string {
+	return filepath.Join(cwd, executor.StateDir, "logs", runID)
+}
+
+// pruneLogs removes the logs of all but the most recent runs.
+func pruneLogs(cwd string) {
+	root := filepath.Join(cwd, executor.StateDir, "logs")
+	entries, err := ioutil.ReadDir(root)
+
+	if err != nil {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() > entries[j].Name()
+	})
+
+	for i := keptLogRuns; i < len(entries); i++ {
+		err = os.RemoveAll(filepath.Join(root, entries[i].Name()))
+
+		if err != nil {
+			log.Println("Unable to remove old logs", err)
+		}
+	}
+}
+
+// taskOutput receives the output of the scripts of a task and copies it to
+// the log file of the task, the event bus and, depending on the output mode,
+// the console.
+type taskOutput struct {
+	task    string
+	events  *events.Bus
+	log     *os.File
+	console *utils.LineWriter
+	group   *bytes.Buffer
+	masked  []string
+}
+
+func openTaskOutput(cwd string, t cogsfile.Task, opts options, masked []string) (*taskOutput, error) {
+	dir := logDir(cwd, opts.runID)
+
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create log directory")
+	}
+
+	f, err := os.Create(filepath.Join(dir, t.Name+".log"))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create log file")
+	}
+
+	o := &taskOutput{task: t.Name, events: opts.events, log: f, masked: masked}
+	prefix := taskPrefix(t.Name)
+
+	switch opts.output {
+	case outputQuiet:
+	case outputGrouped:
+		o.group = &bytes.Buffer{}
+		o.console = utils.NewLineWriter(o.group, prefix, &sync.Mutex{})
+	default:
+		o.console = utils.NewLineWriter(os.Stdout, prefix, &consoleMutex)
+	}
+
+	return o, nil
+}
+
+// writer returns where the output of a phase goes, with secrets masked. It
+// must be flushed once the phase finished.
+func (o *taskOutput) writer(phase string) *secrets.Masker {
+	writers := []io.Writer{o.log, o.events.OutputWriter(o.task, phase)}
+
+	if o.console != nil {
+		writers = append(writers, o.console)
+	}
+
+	return secrets.NewMasker(io.MultiWriter(writers...), o.masked)
+}
+
+// Close writes what is left of the output to the console. In grouped mode
+// that is all of it.
+func (o *taskOutput) Close() error {
+	if o.console != nil {
+		err := o.console.Flush()
+
+		if err != nil {
+			log.Println("Unable to write output", err)
+		}
+	}
+
+	if o.group != nil && o.group.Len() > 0 {
+		consoleMutex.Lock()
+		_, _ = os.Stdout.Write(o.group.Bytes())
+		consoleMutex.Unlock()
+	}
+
+	err := o.log.Close()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to close log file")
+	}
+
+	return nil
+}
+
+// taskPrefix returns the prefix of console lines of a task, colored when the
+// console is a terminal. Each task keeps its color across runs.
+func taskPrefix(task string) string {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return task + " | "
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(task))
+	color := taskColors[hash.Sum32()%uint32(len(taskColors))]
+
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m | ", color, task)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/runner"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// outputFile returns the file, relative to the working directory, a task
+// writes its key=value outputs to.
+func outputFile(task string) string {
+	return filepath.Join(executor.StateDir, "outputs", task)
+}
+
+// resetOutputs removes outputs left over from a previous run.
+func resetOutputs(cwd string) error {
+	err := os.RemoveAll(filepath.Join(cwd, executor.StateDir, "outputs"))
+
+	if err != nil {
+		return errors.Wrap(err, "unable to remove previous outputs")
+	}
+
+	return nil
+}
+
+// prepareOutputs creates an empty output file for the task.
+func prepareOutputs(cwd, task string) error {
+	file := filepath.Join(cwd, outputFile(task))
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+
+	if err == nil {
+		err = ioutil.WriteFile(file, nil, 0644)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to create output file for %s", task)
+	}
+
+	return nil
+}
+
+// readOutputs returns the outputs a task published.
+func readOutputs(cwd, task string) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(cwd, outputFile(task)))
+
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read outputs of %s", task)
+	}
+
+	defer f.Close()
+
+	outputs, err := runner.ParseOutputs(f)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid outputs of %s", task)
+	}
+
+	return outputs, nil
+}
+
+// hasOutputs reports whether the task wrote anything to its output file.
+func hasOutputs(cwd, task string) bool {
+	info, err := os.Stat(filepath.Join(cwd, outputFile(task)))
+
+	return err == nil && info.Size() > 0
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+var reportWriters = map[string]func(io.Writer, *report.Run) error{
+	"junit":    report.WriteJUnit,
+	"markdown": report.WriteMarkdown,
+}
+
+type reportSpec struct {
+	format string
+	path   string
+}
+
+// parseReports parses reports given as format=path.
+func parseReports(specs []string) ([]reportSpec, error) {
+	reports := make([]reportSpec, 0, len(specs))
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, errors.Errorf("expected format=path, got %s", spec)
+		}
+
+		if _, found := reportWriters[parts[0]]; !found {
+			return nil, errors.Errorf("unsupported report format: %s", parts[0])
+		}
+
+		reports = append(reports, reportSpec{format: parts[0], path: parts[1]})
+	}
+
+	return reports, nil
+}
+
+// writeReports writes the reports of a run. Failing to write a report doesn't
+// fail the run.
+func writeReports(reports []reportSpec, run *report.Run) {
+	for _, spec := range reports {
+		err := writeReport(spec, run)
+
+		if err != nil {
+			log.Printf("Unable to write %s report to %s: %s\n", spec.format, spec.path, err)
+			continue
+		}
+
+		log.Printf("Wrote %s report to %s\n", spec.format, spec.path)
+	}
+}
+
+func writeReport(spec reportSpec, run *report.Run) error {
+	f, err := os.Create(spec.path)
+
+	if err != nil {
+		return err
+	}
+
+	err = reportWriters[spec.format](f, run)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/history"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/kinematic-ci/cogs/runner"
+	"github.com/kinematic-ci/cogs/utils"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// resumeLastRun prepares to resume the last recorded run, returning its ID.
+// Tasks which succeeded in it, including those restored from the cache or
+// skipped when it resumed a run itself, may be skipped. Without a recorded
+// run nothing is resumed.
+func resumeLastRun(cwd string) (*runner.Resume, string, error) {
+	last, err := history.NewStore(historyDir(cwd)).Last()
+
+	if err != nil || last == nil {
+		return nil, "", err
+	}
+
+	succeeded := map[string]string{}
+
+	for _, task := range last.Tasks {
+		if task.Status == string(report.Passed) || task.Status == string(report.Skipped) {
+			succeeded[task.Name] = task.Fingerprint
+		}
+	}
+
+	sameCommit := last.SameCommit(utils.GitCommit(cwd), utils.GitDirty(cwd, executor.StateDir))
+
+	return runner.NewResume(succeeded, sameCommit), last.ID, nil
+}
+
+// skipResumed skips a task of a resumed run when it succeeded before with the
+// same inputs and what it left behind is still there: its outputs, the values
+// it published and its artifacts.
+func skipResumed(cwd string, t cogsfile.Task, fingerprint string, opts options) bool {
+	if opts.resume == nil {
+		return false
+	}
+
+	if opts.resume.Skip(t, fingerprint) && keptResults(cwd, t) {
+		log.Printf("Skipping task %s, it succeeded in run %s\n", t.Name, opts.resumedRun)
+		opts.events.Publish(events.Event{Type: events.TaskSkipped, Task: t.Name, Fingerprint: fingerprint, Reason: "resumed"})
+
+		return true
+	}
+
+	opts.resume.Ran(t.Name)
+
+	return false
+}
+
+func keptResults(cwd string, t cogsfile.Task) bool {
+	paths := []string{filepath.Join(cwd, outputFile(t.Name))}
+
+	if len(t.Artifacts) > 0 {
+		paths = append(paths, artifactStore(cwd, t.Name))
+	}
+
+	for _, output := range t.Outputs {
+		paths = append(paths, filepath.Join(cwd, filepath.FromSlash(output)))
+	}
+
+	for _, path := range paths {
+		_, err := os.Stat(path)
+
+		if err != nil {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,50 +3,128 @@ package cli
 import (
 	"context"
 	docker "github.com/docker/docker/client"
+	"github.com/kinematic-ci/cogs/cache"
 	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
 	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/report"
 	"github.com/kinematic-ci/cogs/runner"
+	"github.com/kinematic-ci/cogs/tracing"
 	"github.com/kinematic-ci/cogs/utils"
 	"github.com/pkg/errors"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
 )
 
-const defaultShell = "/bin/sh"
+const (
+	defaultShell     = "/bin/sh"
+	defaultRemoteDir = "cogs"
+)
 
 type options struct {
-	alwaysDocker bool
-	alwaysShell  bool
-	planOnly     bool
+	alwaysDocker   bool
+	alwaysShell    bool
+	planOnly       bool
+	reuse          bool
+	debugOnFailure bool
+	noCache        bool
+	remoteCache    string
+	remoteReadOnly bool
+	events         *events.Bus
+	output         string
+	runID          string
+	resume         *runner.Resume
+	resumedRun     string
 }
 
 type RunArgs struct {
-	Target       string `arg:"positional" default:"" help:"A task to execute. Defaults to the first task in Cogsfile if not specified"`
-	File         string `arg:"-f,--file" help:"Cogsfile for task definitions" default:"cogs.yaml"`
-	AlwaysDocker bool   `arg:"-d,--always-docker" help:"Always use Docker executor"`
-	AlwaysShell  bool   `arg:"-s,--always-shell" help:"Always use Shell executor"`
-	PlanOnly     bool   `arg:"-p,--plan-only" help:"Show execution plan and exit"`
+	Target         string   `arg:"positional" default:"" help:"A task to execute. Defaults to the first task in Cogsfile if not specified"`
+	File           string   `arg:"-f,--file" help:"Cogsfile for task definitions" default:"cogs.yaml"`
+	AlwaysDocker   bool     `arg:"-d,--always-docker" help:"Always use Docker executor"`
+	AlwaysShell    bool     `arg:"-s,--always-shell" help:"Always use Shell executor"`
+	PlanOnly       bool     `arg:"-p,--plan-only" help:"Show execution plan and exit"`
+	Reuse          bool     `arg:"--reuse-containers" help:"Reuse containers across docker tasks with the same image and mounts"`
+	DebugOnFailure bool     `arg:"--debug-on-failure" help:"Open an interactive shell in the task environment when script fails"`
+	NoCache        bool     `arg:"--no-cache" help:"Neither restore task outputs from nor store them in the cache"`
+	RemoteCache    string   `arg:"--remote-cache,env:COGS_REMOTE_CACHE" help:"URL of an HTTP cache shared with other machines"`
+	RemoteReadOnly bool     `arg:"--remote-cache-read-only" help:"Download from the remote cache without uploading to it"`
+	Events         string   `arg:"--events" help:"Write progress events in the given format, only json is supported"`
+	EventsFile     string   `arg:"--events-file" help:"File or fd:N to write events to, required with --events"`
+	Reports        []string `arg:"--report,separate" help:"Write a report as format=path, formats are junit and markdown, may be repeated"`
+	Output         string   `arg:"--output" default:"interleaved" help:"How task output is shown: interleaved, grouped by task or quiet"`
+	TraceEndpoint  string   `arg:"--trace-endpoint,env:OTEL_EXPORTER_OTLP_ENDPOINT" help:"OTLP/HTTP collector to export a trace of the run to"`
+	TraceFile      string   `arg:"--trace-file" help:"File to write a trace of the run to as OTLP JSON"`
+	Timings        bool     `arg:"--timings" help:"Show how long tasks and their phases took once the run ended"`
+	Resume         bool     `arg:"--resume" help:"Skip tasks which succeeded in the last run and whose inputs did not change"`
 }
 
 func Run(args *RunArgs) {
 	opts := options{
-		alwaysDocker: args.AlwaysDocker,
-		alwaysShell:  args.AlwaysShell,
-		planOnly:     args.PlanOnly,
+		alwaysDocker:   args.AlwaysDocker,
+		alwaysShell:    args.AlwaysShell,
+		planOnly:       args.PlanOnly,
+		reuse:          args.Reuse,
+		debugOnFailure: args.DebugOnFailure,
+		noCache:        args.NoCache,
+		remoteCache:    args.RemoteCache,
+		remoteReadOnly: args.RemoteReadOnly,
+		output:         args.Output,
+	}
+
+	err := validateOutputMode(opts.output)
+
+	if err != nil {
+		log.Fatalln("Invalid output mode", err)
+	}
+
+	cogs := mustLoadCogsfile(args.File, opts)
+
+	if args.Resume {
+		cwd, err := os.Getwd()
+
+		if err == nil {
+			opts.resume, opts.resumedRun, err = resumeLastRun(cwd)
+		}
+
+		if err != nil {
+			log.Fatalln("Unable to resume last run", err)
+		}
+
+		if opts.resume == nil {
+			log.Println("No run to resume, running all tasks")
+		} else {
+			log.Printf("Resuming run %s\n", opts.resumedRun)
+		}
 	}
 
-	bytes, err := ioutil.ReadFile(args.File)
+	opts.events = events.NewBus()
+
+	closeEvents, err := subscribeEvents(opts.events, args.Events, args.EventsFile)
 
 	if err != nil {
-		log.Fatalln("Error opening Cogsfile:", err)
+		log.Fatalln("Unable to open event stream", err)
 	}
 
-	cogs, err := cogsfile.Load(bytes)
+	defer closeEvents()
+
+	reports, err := parseReports(args.Reports)
 
 	if err != nil {
-		log.Fatalln("Error parsing Cogsfile", err)
+		log.Fatalln("Invalid report", err)
+	}
+
+	collector := report.NewCollector()
+	opts.events.Subscribe(collector.Handle)
+
+	tracer := tracing.NewTracer()
+
+	if args.TraceEndpoint != "" || args.TraceFile != "" {
+		opts.events.Subscribe(tracer.Handle)
 	}
 
 	client, err := docker.NewClientWithOpts(docker.FromEnv)
@@ -54,10 +132,22 @@ func Run(args *RunArgs) {
 		log.Fatalln("Error creating docker client", err)
 	}
 
-	ctx := context.Background()
+	ctx, cancel := cancelOnSignal(context.Background())
+	defer cancel()
 
 	err = runCogs(ctx, cogs, args.Target, opts, client)
 
+	writeReports(reports, collector.Run())
+	exportTrace(tracer, args.TraceEndpoint, args.TraceFile)
+
+	if args.Timings {
+		printTimings(cogs, collector.Run())
+	}
+
+	if !opts.planOnly {
+		recordRun(collector.Run())
+	}
+
 	if err != nil {
 		log.Fatalln("Task failed", err)
 	}
@@ -65,6 +155,27 @@ func Run(args *RunArgs) {
 	log.Println("Task completed successfully")
 }
 
+// cancelOnSignal cancels the context on SIGINT or SIGTERM, so that running
+// sessions can clean up the processes they started.
+func cancelOnSignal(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("Received %s, cancelling\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
 func runCogs(ctx context.Context, c *cogsfile.Cogsfile, target string, opts options, client *docker.Client) error {
 	if target == "" {
 		target = c.Tasks[0].Name
@@ -76,10 +187,86 @@ func runCogs(ctx context.Context, c *cogsfile.Cogsfile, target string, opts opti
 		return errors.Wrap(err, "unable to determine execution order")
 	}
 
+	var pool *executor.ContainerPool
+
+	if opts.reuse && !opts.planOnly {
+		pool = executor.NewContainerPool(client)
+
+		defer func() {
+			err := pool.Close(ctx)
+
+			if err != nil {
+				log.Println("Error closing container pool", err)
+			}
+		}()
+	}
+
+	var taskCache *cache.Cache
+
+	if !opts.noCache && !opts.planOnly {
+		taskCache = openCache(opts)
+	}
+
+	if !opts.planOnly {
+		cwd, err := os.Getwd()
+
+		if err != nil {
+			return errors.Wrap(err, "cannot determine cwd")
+		}
+
+		// A resumed run keeps the artifacts and published outputs of the
+		// tasks it skips.
+		if opts.resume == nil {
+			err = resetArtifacts(cwd)
+
+			if err == nil {
+				err = resetOutputs(cwd)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		pruneLogs(cwd)
+	}
+
+	opts.runID = newRunID()
+
+	if !opts.planOnly {
+		log.Printf("Starting run %s\n", opts.runID)
+	}
+
+	opts.events.Publish(events.Event{Type: events.RunStarted, Run: opts.runID, Target: target, Tasks: taskNames(taskList.Values())})
+
 	for _, task := range taskList.Values() {
+		opts.events.Publish(events.Event{Type: events.TaskPlanned, Task: task.Name, Executor: executorName(task, opts)})
+	}
+
+	err = executeTasks(ctx, taskList.Values(), map[string]map[string]string{}, opts, client, pool, taskCache)
+
+	opts.events.Publish(events.Event{Type: events.RunFinished, Run: opts.runID, Target: target}.WithError(err))
+
+	return err
+}
+
+func taskNames(tasks []cogsfile.Task) []string {
+	names := make([]string, len(tasks))
+
+	for i, task := range tasks {
+		names[i] = task.Name
+	}
+
+	return names
+}
+
+// executeTasks runs the tasks in order, recording the outputs each of them
+// published.
+func executeTasks(ctx context.Context, tasks []cogsfile.Task, outputs map[string]map[string]string, opts options, client *docker.Client, pool *executor.ContainerPool, taskCache *cache.Cache) error {
+	for _, task := range tasks {
 		if !opts.planOnly {
 			log.Printf("Executing task %s\n", task.Name)
-			err := runTask(ctx, task, opts, client)
+			err := runTaskWithOutputs(ctx, task, outputs, opts, client, pool, taskCache)
 
 			if err != nil {
 				return errors.Wrap(err, "error executing task")
@@ -92,67 +279,203 @@ func runCogs(ctx context.Context, c *cogsfile.Cogsfile, target string, opts opti
 	return nil
 }
 
-func runTask(ctx context.Context, t cogsfile.Task, opts options, client *docker.Client) error {
+// runTaskWithOutputs resolves the outputs of dependencies used by the task,
+// runs it and records the outputs it published.
+func runTaskWithOutputs(ctx context.Context, t cogsfile.Task, outputs map[string]map[string]string, opts options, client *docker.Client, pool *executor.ContainerPool, taskCache *cache.Cache) error {
 	cwd, err := os.Getwd()
 
 	if err != nil {
 		return errors.Wrap(err, "cannot determine cwd")
 	}
 
-	shell := utils.StringOrDefault(t.Shell, defaultShell)
-	shellArgs := getShellArgs(t.ShellArgs)
+	t, err = loadEnvFiles(cwd, t)
 
-	var e executor.Executor
+	if err != nil {
+		return err
+	}
 
-	if opts.alwaysDocker {
-		log.Println("Overriding executor to use docker")
-		e = executor.NewDockerExecutor(t.Name, t.Image, cwd, shell, shellArgs, client)
-	} else if opts.alwaysShell {
-		log.Println("Overriding executor to use shell")
-		e = executor.NewShellExecutor(cwd, shell, shellArgs)
-	} else {
-		switch t.Executor {
-		case cogsfile.Docker:
-			e = executor.NewDockerExecutor(t.Name, t.Image, cwd, shell, shellArgs, client)
-		case cogsfile.Shell:
-			e = executor.NewShellExecutor(cwd, shell, shellArgs)
-		default:
-			log.Panicf("Unknown executor: %s\n", t.Executor)
+	resolved, err := runner.ResolveOutputs(t, outputs)
+
+	if err != nil {
+		return err
+	}
+
+	// The fingerprint identifies the inputs of the task in the history and
+	// is the key it is cached under.
+	fingerprint, err := cacheKey(ctx, resolved, opts, client, cwd)
+
+	if err != nil {
+		log.Println("Unable to compute fingerprint", err)
+		fingerprint = ""
+	}
+
+	if !skipResumed(cwd, resolved, fingerprint, opts) {
+		err = prepareOutputs(cwd, t.Name)
+
+		if err != nil {
+			return err
+		}
+
+		err = runCachedTask(ctx, resolved, fingerprint, opts, client, pool, taskCache)
+
+		if err != nil {
+			return err
 		}
 	}
 
+	published, err := readOutputs(cwd, t.Name)
+
+	if err != nil {
+		return err
+	}
+
+	if len(published) > 0 {
+		log.Printf("Task %s published %d outputs\n", t.Name, len(published))
+	}
+
+	outputs[t.Name] = published
+
+	return nil
+}
+
+// runTask runs a task and returns its fingerprint once it ran. The digest of
+// an image is only known once the run pulled it, so the fingerprint of tasks
+// running in one is computed again, which is the one the next run computes
+// before running the task.
+func runTask(ctx context.Context, t cogsfile.Task, fingerprint string, opts options, client *docker.Client, pool *executor.ContainerPool) (string, error) {
+	opts.events.Publish(events.Event{Type: events.TaskStarted, Task: t.Name, Fingerprint: fingerprint})
+
+	err := runPhases(ctx, t, opts, client, pool)
+
+	if name := executorName(t, opts); err == nil && fingerprint != "" && (name == executor.Docker || name == executor.Podman) {
+		fingerprint = pulledFingerprint(ctx, t, fingerprint, opts, client)
+	}
+
+	opts.events.Publish(events.Event{Type: events.TaskFinished, Task: t.Name, Fingerprint: fingerprint}.WithError(err))
+
+	return fingerprint, err
+}
+
+func pulledFingerprint(ctx context.Context, t cogsfile.Task, fingerprint string, opts options, client *docker.Client) string {
+	cwd, err := os.Getwd()
+
+	if err == nil {
+		var pulled string
+		pulled, err = cacheKey(ctx, t, opts, client, cwd)
+
+		if err == nil {
+			return pulled
+		}
+	}
+
+	log.Println("Unable to compute fingerprint", err)
+
+	return fingerprint
+}
+
+func runPhases(ctx context.Context, t cogsfile.Task, opts options, client *docker.Client, pool *executor.ContainerPool) (err error) {
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		return errors.Wrap(err, "cannot determine cwd")
+	}
+
+	err = installArtifacts(t, cwd)
+
+	if err != nil {
+		return err
+	}
+
+	secretValues, err := loadSecrets(cwd, t)
+
+	if err != nil {
+		return err
+	}
+
+	output, err := openTaskOutput(cwd, t, opts, masked(secretValues))
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := output.Close()
+
+		if err != nil {
+			log.Println("Error closing task output", err)
+		}
+	}()
+
+	e, err := newExecutor(t, secretValues, opts, client, pool)
+
+	if err != nil {
+		return errors.Wrap(err, "cannot create executor")
+	}
+
 	log.Printf("Using executor: %s\n", e.Name())
+	opts.events.Publish(events.Event{Type: events.ExecutorCreated, Task: t.Name, Executor: e.Name()})
 
+	// The executor is closed even when the run was cancelled, so that
+	// containers and connections don't outlive it.
 	defer func() {
 		log.Println("Closing executor")
 
-		err = e.Close(ctx)
+		closeErr := e.Close(context.Background())
+		opts.events.Publish(events.Event{Type: events.ExecutorClosed, Task: t.Name, Executor: e.Name()}.WithError(closeErr))
 
-		if err != nil {
-			log.Fatalln("Error closing executor", err)
+		if closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "error closing executor")
+		} else if closeErr != nil {
+			log.Println("Error closing executor", closeErr)
 		}
 	}()
 
+	scriptCtx := ctx
+
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		scriptCtx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
 	log.Println("Executing before_script")
-	exitCode, err := runScript(ctx, e, t.BeforeScript)
+	exitCode, err := runPhase(scriptCtx, e, t, events.BeforeScript, t.BeforeScript, output, opts)
 
 	if err != nil {
 		return errors.Wrap(err, "error executing before_script")
 	}
 
 	if exitCode != 0 {
-		log.Fatalf("before_script failed with exit code %d\n", exitCode)
+		return errors.Errorf("before_script failed with exit code %d", exitCode)
 	}
 
 	log.Println("Executing script")
-	scriptExitCode, err := runScript(ctx, e, t.Script)
+	scriptExitCode, err := runPhase(scriptCtx, e, t, events.Script, t.Script, output, opts)
 
 	if err != nil {
 		return errors.Wrap(err, "error executing script")
 	}
 
+	if scriptExitCode == 0 {
+		err = collectArtifacts(ctx, e, t, cwd)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if scriptExitCode != 0 && opts.debugOnFailure {
+		log.Printf("script failed with exit code %d, opening debug shell\n", scriptExitCode)
+
+		err = openShell(ctx, e)
+
+		if err != nil {
+			log.Println("Unable to open debug shell", err)
+		}
+	}
+
 	log.Println("Executing after_script")
-	exitCode, err = runScript(ctx, e, t.AfterScript)
+	exitCode, err = runPhase(ctx, e, t, events.AfterScript, t.AfterScript, output, opts)
 
 	if err != nil {
 		return errors.Wrap(err, "error executing after_script")
@@ -163,12 +486,142 @@ func runTask(ctx context.Context, t cogsfile.Task, opts options, client *docker.
 	}
 
 	if scriptExitCode != 0 {
-		return errors.Errorf("script failed with exit code %d\n", exitCode)
+		return errors.Errorf("script failed with exit code %d", scriptExitCode)
 	}
 
 	return nil
 }
 
+func newExecutor(t cogsfile.Task, secretValues map[string]string, opts options, client *docker.Client, pool *executor.ContainerPool) (executor.Executor, error) {
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot determine cwd")
+	}
+
+	options, err := containerOptions(t)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid container options")
+	}
+
+	config := executor.Config{
+		Task:             t.Name,
+		Image:            t.Image,
+		WorkingDirectory: cwd,
+		Shell:            utils.StringOrDefault(t.Shell, defaultShell),
+		ShellArgs:        getShellArgs(t.ShellArgs),
+		Tty:              t.Tty,
+		Container:        options,
+		SSH:              sshConfig(t),
+		Sandbox:          sandboxConfig(t, cwd),
+		Env:              taskEnv(t, secretValues),
+		OutputFile:       outputFile(t.Name),
+		Docker:           client,
+		Pool:             pool,
+		Events:           opts.events,
+	}
+
+	name := executorName(t, opts)
+
+	if name != t.Executor {
+		log.Printf("Overriding executor to use %s\n", name)
+	}
+
+	return executor.New(name, config)
+}
+
+func executorName(t cogsfile.Task, opts options) string {
+	if opts.alwaysDocker {
+		return executor.Docker
+	} else if opts.alwaysShell {
+		return executor.Shell
+	}
+
+	return t.Executor
+}
+
+func openShell(ctx context.Context, e executor.Executor) error {
+	interactive, ok := e.(executor.Interactive)
+
+	if !ok {
+		return errors.Errorf("executor %s does not support interactive shells", e.Name())
+	}
+
+	log.Println("Exit the shell to continue")
+
+	return interactive.Interactive(ctx)
+}
+
+func sshConfig(t cogsfile.Task) executor.SSHConfig {
+	return executor.SSHConfig{
+		Host:                  t.SSH.Host,
+		Port:                  t.SSH.Port,
+		User:                  t.SSH.User,
+		KeyFile:               t.SSH.Key,
+		KnownHostsFile:        t.SSH.KnownHosts,
+		InsecureIgnoreHostKey: t.SSH.InsecureIgnoreHostKey,
+		RemoteDir:             utils.StringOrDefault(t.SSH.RemoteDir, path.Join(defaultRemoteDir, t.Name)),
+		Outputs:               t.Outputs,
+	}
+}
+
+func sandboxConfig(t cogsfile.Task, cwd string) *executor.SandboxConfig {
+	if !t.Sandbox.Enabled {
+		return nil
+	}
+
+	writablePaths := make([]string, 0, len(t.Sandbox.WritablePaths))
+
+	for _, writablePath := range t.Sandbox.WritablePaths {
+		if !filepath.IsAbs(writablePath) {
+			writablePath = filepath.Join(cwd, writablePath)
+		}
+
+		writablePaths = append(writablePaths, writablePath)
+	}
+
+	return &executor.SandboxConfig{WritablePaths: writablePaths, Network: t.Sandbox.Network}
+}
+
+func containerOptions(t cogsfile.Task) (executor.ContainerOptions, error) {
+	memory, err := t.Resources.MemoryBytes()
+
+	if err != nil {
+		return executor.ContainerOptions{}, err
+	}
+
+	options := executor.ContainerOptions{
+		WorkingDir:  t.WorkingDir,
+		CPUs:        t.Resources.CPUs,
+		Memory:      memory,
+		PidsLimit:   t.Resources.Pids,
+		NetworkMode: t.NetworkMode,
+		Privileged:  t.Privileged,
+		CapAdd:      t.CapAdd,
+		ExtraHosts:  t.ExtraHosts,
+		Platform:    t.Platform,
+		Tty:         t.Tty,
+	}
+
+	for _, v := range t.Volumes {
+		options.Volumes = append(options.Volumes, executor.Volume{
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+
+	for _, c := range t.Caches {
+		options.Caches = append(options.Caches, executor.Cache{
+			Name: c.Name,
+			Path: c.Path,
+		})
+	}
+
+	return options, nil
+}
+
 func getShellArgs(args []string) []string {
 	combinedArgs := []string{"-xe"}
 
@@ -179,7 +632,33 @@ func getShellArgs(args []string) []string {
 	return combinedArgs
 }
 
-func runScript(ctx context.Context, e executor.Executor, script []string) (int, error) {
+// runPhase runs one of the scripts of a task.
+func runPhase(ctx context.Context, e executor.Executor, t cogsfile.Task, phase string, script cogsfile.Script, output *taskOutput, opts options) (int, error) {
+	opts.events.Publish(events.Event{Type: events.PhaseStarted, Task: t.Name, Phase: phase})
+
+	writer := output.writer(phase)
+	exitCode, err := runScript(ctx, e, script, writer)
+	flushErr := writer.Flush()
+
+	if err == nil && flushErr != nil {
+		err = errors.Wrap(flushErr, "error writing output")
+	}
+
+	finished := events.Event{Type: events.PhaseFinished, Task: t.Name, Phase: phase}
+
+	if err == nil {
+		finished = finished.WithExitCode(exitCode)
+	}
+
+	opts.events.Publish(finished.WithError(err))
+
+	return exitCode, err
+}
+
+func runScript(ctx context.Context, e executor.Executor, script cogsfile.Script, output io.Writer) (int, error) {
+	if runner, ok := e.(executor.CommandRunner); ok {
+		return runCommands(ctx, runner, script, output)
+	}
 
 	session, err := e.Session(ctx)
 
@@ -192,7 +671,7 @@ func runScript(ctx context.Context, e executor.Executor, script []string) (int,
 	done := make(chan error)
 
 	go func() {
-		err = streamOutput(session.Reader())
+		err = streamOutput(session.Reader(), output)
 
 		if err != nil {
 			done <- errors.Wrap(err, "error reading output from container")
@@ -200,7 +679,7 @@ func runScript(ctx context.Context, e executor.Executor, script []string) (int,
 		done <- nil
 	}()
 
-	for _, cmd := range script {
+	for _, cmd := range script.Lines() {
 		err = mustWrite(session.Writer(), cmd)
 
 		if err != nil {
@@ -226,8 +705,26 @@ func runScript(ctx context.Context, e executor.Executor, script []string) (int,
 
 }
 
-func streamOutput(reader io.Reader) error {
-	size, err := io.Copy(os.Stdout, reader)
+func runCommands(ctx context.Context, runner executor.CommandRunner, script cogsfile.Script, output io.Writer) (int, error) {
+	commands := make([][]string, 0, len(script))
+
+	for _, command := range script {
+		argv, err := command.Words()
+
+		if err != nil {
+			return -1, errors.Wrapf(err, "invalid command %s", command.Line)
+		}
+
+		if len(argv) > 0 {
+			commands = append(commands, argv)
+		}
+	}
+
+	return runner.RunCommands(ctx, commands, output)
+}
+
+func streamOutput(reader io.Reader, output io.Writer) error {
+	size, err := io.Copy(output, reader)
 	if err != nil {
 		return errors.Wrap(err, "error reading from stream")
 	}
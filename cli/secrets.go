@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadSecrets reads the values of the secrets of a task.
+func loadSecrets(cwd string, t cogsfile.Task) (map[string]string, error) {
+	values := make(map[string]string, len(t.Secrets))
+
+	for _, secret := range t.Secrets {
+		value, err := readSecret(cwd, secret)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read secret %s", secret.Name)
+		}
+
+		values[secret.Name] = value
+	}
+
+	return values, nil
+}
+
+func readSecret(cwd string, secret cogsfile.Secret) (string, error) {
+	var file string
+
+	switch secret.Source() {
+	case "file":
+		file = utils.ExpandHome(secret.File)
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(cwd, file)
+		}
+	case "store":
+		file = filepath.Join(cwd, executor.StateDir, "secrets", secret.Store)
+	default:
+		name := utils.StringOrDefault(secret.Env, secret.Name)
+		value, found := os.LookupEnv(name)
+
+		if !found {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+
+		return value, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// taskEnv returns the environment variables of a task along with its secrets.
+func taskEnv(t cogsfile.Task, secretValues map[string]string) map[string]string {
+	if len(secretValues) == 0 {
+		return t.EnvVars
+	}
+
+	env := make(map[string]string, len(t.EnvVars)+len(secretValues))
+
+	for name, value := range t.EnvVars {
+		env[name] = value
+	}
+
+	for name, value := range secretValues {
+		env[name] = value
+	}
+
+	return env
+}
+
+// masked returns the values to mask in the output of a task.
+func masked(secretValues map[string]string) []string {
+	values := make([]string, 0, len(secretValues))
+
+	for _, value := range secretValues {
+		values = append(values, value)
+	}
+
+	return values
+}
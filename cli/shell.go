@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	docker "github.com/docker/docker/client"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/secrets"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+)
+
+type ShellArgs struct {
+	Task         string `arg:"positional,required" help:"The task whose environment should be opened"`
+	File         string `arg:"-f,--file" help:"Cogsfile for task definitions" default:"cogs.yaml"`
+	AlwaysDocker bool   `arg:"-d,--always-docker" help:"Always use Docker executor"`
+	AlwaysShell  bool   `arg:"-s,--always-shell" help:"Always use Shell executor"`
+	BeforeScript bool   `arg:"-b,--before-script" help:"Run before_script before opening the shell"`
+}
+
+func Shell(args *ShellArgs) {
+	opts := options{
+		alwaysDocker: args.AlwaysDocker,
+		alwaysShell:  args.AlwaysShell,
+	}
+
+	cogs := mustLoadCogsfile(args.File, opts)
+
+	client, err := docker.NewClientWithOpts(docker.FromEnv)
+	if err != nil {
+		log.Fatalln("Error creating docker client", err)
+	}
+
+	ctx := context.Background()
+
+	err = openTaskShell(ctx, cogs, args.Task, args.BeforeScript, opts, client)
+
+	if err != nil {
+		log.Fatalln("Unable to open shell", err)
+	}
+}
+
+func openTaskShell(ctx context.Context, c *cogsfile.Cogsfile, name string, beforeScript bool, opts options, client *docker.Client) error {
+	task, found := c.Task(name)
+
+	if !found {
+		return errors.Errorf("task '%s' not found", name)
+	}
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		return errors.Wrap(err, "cannot determine cwd")
+	}
+
+	task, err = loadEnvFiles(cwd, task)
+
+	if err != nil {
+		return err
+	}
+
+	secretValues, err := loadSecrets(cwd, task)
+
+	if err != nil {
+		return err
+	}
+
+	e, err := newExecutor(task, secretValues, opts, client, nil)
+
+	if err != nil {
+		return errors.Wrap(err, "cannot create executor")
+	}
+
+	log.Printf("Using executor: %s\n", e.Name())
+
+	defer func() {
+		log.Println("Closing executor")
+
+		err := e.Close(ctx)
+
+		if err != nil {
+			log.Println("Error closing executor", err)
+		}
+	}()
+
+	if beforeScript {
+		log.Println("Executing before_script")
+		output := secrets.NewMasker(os.Stdout, masked(secretValues))
+		exitCode, err := runScript(ctx, e, task.BeforeScript, output)
+
+		if err == nil {
+			err = output.Flush()
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "error executing before_script")
+		}
+
+		if exitCode != 0 {
+			return errors.Errorf("before_script failed with exit code %d", exitCode)
+		}
+	}
+
+	return openShell(ctx, e)
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/pkg/errors"
 	"io/ioutil"
 	"log"
 	"strings"
@@ -15,7 +16,18 @@ type TasksArgs struct {
 }
 
 func Tasks(args *TasksArgs) {
-	bytes, err := ioutil.ReadFile(args.File)
+	cogs := mustLoadCogsfile(args.File, options{})
+
+	println("Available tasks:")
+	for _, task := range cogs.Tasks {
+		printTwoCols(task.Name, task.Description)
+	}
+}
+
+// mustLoadCogsfile loads the Cogsfile and checks that the executors chosen by
+// --always-docker or --always-shell accept its tasks.
+func mustLoadCogsfile(file string, opts options) *cogsfile.Cogsfile {
+	bytes, err := ioutil.ReadFile(file)
 
 	if err != nil {
 		log.Fatalln("Error opening Cogsfile:", err)
@@ -27,10 +39,22 @@ func Tasks(args *TasksArgs) {
 		log.Fatalln("Error parsing Cogsfile", err)
 	}
 
-	println("Available tasks:")
-	for _, task := range cogs.Tasks {
-		printTwoCols(task.Name, task.Description)
+	for i, task := range cogs.Tasks {
+		name := executorName(task, opts)
+
+		if name == task.Executor {
+			continue
+		}
+
+		task.Executor = name
+		err = cogsfile.ValidateExecutor(task)
+
+		if err != nil {
+			log.Fatalln("Error parsing Cogsfile", errors.Wrapf(err, "validation failed for task: %s at %d", task.Name, i))
+		}
 	}
+
+	return cogs
 }
 
 func printTwoCols(left, right string) {
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/kinematic-ci/cogs/runner"
+	"log"
+	"os"
+	"time"
+)
+
+// printTimings shows how long the tasks of a run took and which of them are
+// on its critical path.
+func printTimings(c *cogsfile.Cogsfile, run *report.Run) {
+	if run.Target == "" {
+		return
+	}
+
+	durations := map[string]time.Duration{}
+
+	for _, task := range run.Tasks {
+		if !task.Started.IsZero() && !task.Finished.IsZero() {
+			durations[task.Name] = task.Duration()
+		}
+	}
+
+	path, _, err := runner.CriticalPath(c.Tasks, run.Target, durations)
+
+	if err != nil {
+		log.Println("Unable to determine critical path", err)
+	}
+
+	consoleMutex.Lock()
+	defer consoleMutex.Unlock()
+
+	err = report.WriteTimings(os.Stdout, run, path)
+
+	if err != nil {
+		log.Println("Unable to show timings", err)
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"github.com/kinematic-ci/cogs/tracing"
+	"log"
+	"os"
+	"time"
+)
+
+const traceExportTimeout = 30 * time.Second
+
+// exportTrace sends the trace of a run to an OTLP/HTTP collector and writes
+// it to a file. Failing to export the trace doesn't fail the run.
+func exportTrace(tracer *tracing.Tracer, endpoint, file string) {
+	spans := tracer.Spans()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	if endpoint != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+		err := tracing.ExportOTLP(ctx, endpoint, spans)
+		cancel()
+
+		if err != nil {
+			log.Println("Unable to export trace", err)
+		} else {
+			log.Printf("Exported trace of %d spans to %s\n", len(spans), endpoint)
+		}
+	}
+
+	if file != "" {
+		err := writeTrace(file, spans)
+
+		if err != nil {
+			log.Printf("Unable to write trace to %s: %s\n", file, err)
+		} else {
+			log.Printf("Wrote trace to %s\n", file)
+		}
+	}
+}
+
+func writeTrace(file string, spans []tracing.Span) error {
+	f, err := os.Create(file)
+
+	if err != nil {
+		return err
+	}
+
+	err = tracing.WriteOTLP(f, spans)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
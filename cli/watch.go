@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"context"
+	docker "github.com/docker/docker/client"
+	"github.com/kinematic-ci/cogs/cache"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/executor"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/kinematic-ci/cogs/runner"
+	"github.com/kinematic-ci/cogs/watch"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type WatchArgs struct {
+	Target       string        `arg:"positional" default:"" help:"A task to execute. Defaults to the first task in Cogsfile if not specified"`
+	File         string        `arg:"-f,--file" help:"Cogsfile for task definitions" default:"cogs.yaml"`
+	AlwaysDocker bool          `arg:"-d,--always-docker" help:"Always use Docker executor"`
+	AlwaysShell  bool          `arg:"-s,--always-shell" help:"Always use Shell executor"`
+	Reuse        bool          `arg:"--reuse-containers" help:"Reuse containers across docker tasks with the same image and mounts"`
+	NoCache      bool          `arg:"--no-cache" help:"Neither restore task outputs from nor store them in the cache"`
+	Ignore       []string      `arg:"--ignore,separate" help:"A pattern of files whose changes are ignored, may be repeated"`
+	Debounce     time.Duration `arg:"--debounce" default:"300ms" help:"How long files must stay unchanged before tasks run again"`
+	Events       string        `arg:"--events" help:"Write progress events in the given format, only json is supported"`
+	EventsFile   string        `arg:"--events-file" help:"File or fd:N to write events to, required with --events"`
+}
+
+func Watch(args *WatchArgs) {
+	opts := options{
+		alwaysDocker: args.AlwaysDocker,
+		alwaysShell:  args.AlwaysShell,
+		reuse:        args.Reuse,
+		noCache:      args.NoCache,
+		output:       outputInterleaved,
+	}
+
+	cogs := mustLoadCogsfile(args.File, opts)
+
+	opts.events = events.NewBus()
+
+	closeEvents, err := subscribeEvents(opts.events, args.Events, args.EventsFile)
+
+	if err != nil {
+		log.Fatalln("Unable to open event stream", err)
+	}
+
+	defer closeEvents()
+
+	client, err := docker.NewClientWithOpts(docker.FromEnv)
+	if err != nil {
+		log.Fatalln("Error creating docker client", err)
+	}
+
+	ctx, cancel := cancelOnSignal(context.Background())
+	defer cancel()
+
+	err = watchCogs(ctx, cogs, args.Target, args.Ignore, args.Debounce, opts, client)
+
+	if err != nil {
+		log.Fatalln("Watch failed", err)
+	}
+}
+
+// watchCogs runs the target and then runs the tasks affected by changed files
+// again whenever files change, cancelling a run still in progress.
+func watchCogs(ctx context.Context, c *cogsfile.Cogsfile, target string, ignore []string, debounce time.Duration, opts options, client *docker.Client) error {
+	if target == "" {
+		target = c.Tasks[0].Name
+	}
+
+	_, err := runner.ExecutionOrder(c.Tasks, target)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to determine execution order")
+	}
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		return errors.Wrap(err, "cannot determine cwd")
+	}
+
+	watcher, err := watch.New(cwd, append(watchIgnores(c.Tasks), ignore...), debounce)
+
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	var pool *executor.ContainerPool
+
+	if opts.reuse {
+		pool = executor.NewContainerPool(client)
+
+		defer func() {
+			err := pool.Close(context.Background())
+
+			if err != nil {
+				log.Println("Error closing container pool", err)
+			}
+		}()
+	}
+
+	var taskCache *cache.Cache
+
+	if !opts.noCache {
+		taskCache = openCache(opts)
+	}
+
+	err = resetArtifacts(cwd)
+
+	if err == nil {
+		err = resetOutputs(cwd)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Tasks which are not affected by a change keep the outputs and
+	// artifacts of the run they last completed in.
+	outputs := map[string]map[string]string{}
+	var changed []string
+
+	for {
+		completed := map[string]bool{}
+
+		for name := range outputs {
+			completed[name] = true
+		}
+
+		affected, err := runner.Affected(c.Tasks, target, changed, completed)
+
+		if err != nil {
+			return err
+		}
+
+		tasks := affected.Values()
+
+		if len(tasks) == 0 {
+			log.Printf("No tasks affected by changes to %s\n", strings.Join(changed, ", "))
+		} else {
+			for _, task := range tasks {
+				delete(outputs, task.Name)
+			}
+
+			changed = runUntilChanged(ctx, target, tasks, outputs, watcher, opts, client, pool, taskCache)
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if changed != nil {
+				continue
+			}
+		}
+
+		log.Println("Waiting for changes")
+
+		select {
+		case changed = <-watcher.Changes():
+			log.Printf("Files changed: %s\n", strings.Join(changed, ", "))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// runUntilChanged runs the tasks, unless files change first. It returns the
+// changed files when the run was cancelled because of them. Every run is
+// recorded in the history, cancelled ones too.
+func runUntilChanged(ctx context.Context, target string, tasks []cogsfile.Task, outputs map[string]map[string]string, watcher *watch.Watcher, opts options, client *docker.Client, pool *executor.ContainerPool, taskCache *cache.Cache) []string {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts.runID = newRunID()
+
+	// Each run is collected on a bus of its own, which passes its events on
+	// to the subscribers of the whole watch.
+	collector := report.NewCollector()
+	bus := events.NewBus()
+	bus.Subscribe(opts.events.Publish)
+	bus.Subscribe(collector.Handle)
+	opts.events = bus
+
+	log.Printf("Starting run %s\n", opts.runID)
+
+	opts.events.Publish(events.Event{Type: events.RunStarted, Run: opts.runID, Target: target, Tasks: taskNames(tasks)})
+
+	for _, task := range tasks {
+		opts.events.Publish(events.Event{Type: events.TaskPlanned, Task: task.Name, Executor: executorName(task, opts)})
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- executeTasks(runCtx, tasks, outputs, opts, client, pool, taskCache)
+	}()
+
+	finish := func(err error) {
+		opts.events.Publish(events.Event{Type: events.RunFinished, Run: opts.runID, Target: target}.WithError(err))
+		recordRun(collector.Run())
+	}
+
+	select {
+	case err := <-done:
+		finish(err)
+
+		if err != nil {
+			log.Println("Task failed", err)
+		} else {
+			log.Println("Task completed successfully")
+		}
+
+		return nil
+	case changed := <-watcher.Changes():
+		log.Printf("Files changed: %s, cancelling run\n", strings.Join(changed, ", "))
+		cancel()
+		finish(<-done)
+
+		return changed
+	case <-ctx.Done():
+		finish(<-done)
+
+		return nil
+	}
+}
+
+// watchIgnores returns the files that change while tasks run: those in the
+// state directory, outputs of tasks and artifacts installed into the working
+// directory.
+func watchIgnores(tasks []cogsfile.Task) []string {
+	ignores := []string{".git", executor.StateDir}
+
+	for _, task := range tasks {
+		ignores = append(ignores, task.Outputs...)
+
+		// Absolute artifacts are outside of the working directory.
+		for _, artifact := range task.Artifacts {
+			if !path.IsAbs(artifact) {
+				ignores = append(ignores, artifact)
+			}
+		}
+	}
+
+	return ignores
+}
@@ -0,0 +1,67 @@
+package cogsfile
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+)
+
+// Validator checks the settings of a task which only matter to its executor.
+type Validator func(task Task) error
+
+var (
+	executorsMutex   sync.RWMutex
+	executors        = map[string]Validator{}
+	executorPrefixes = map[string]Validator{}
+)
+
+// RegisterExecutor makes name a valid executor for tasks, validate may be nil.
+// Executors are registered by the executor package when it is initialised.
+func RegisterExecutor(name string, validate Validator) {
+	executorsMutex.Lock()
+	defer executorsMutex.Unlock()
+
+	executors[name] = validate
+}
+
+// RegisterExecutorPrefix makes every name made of prefix and a non-empty
+// suffix a valid executor for tasks, validate may be nil.
+func RegisterExecutorPrefix(prefix string, validate Validator) {
+	executorsMutex.Lock()
+	defer executorsMutex.Unlock()
+
+	executorPrefixes[prefix] = validate
+}
+
+// ValidateExecutor checks that the executor of a task is registered and that
+// it accepts the settings of the task.
+func ValidateExecutor(task Task) error {
+	validate, found := lookupExecutor(task.Executor)
+
+	if !found {
+		return errors.Errorf("unsupported executor: %s", task.Executor)
+	}
+
+	if validate == nil {
+		return nil
+	}
+
+	return validate(task)
+}
+
+func lookupExecutor(name string) (Validator, bool) {
+	executorsMutex.RLock()
+	defer executorsMutex.RUnlock()
+
+	if validate, found := executors[name]; found {
+		return validate, true
+	}
+
+	for prefix, validate := range executorPrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return validate, true
+		}
+	}
+
+	return nil, false
+}
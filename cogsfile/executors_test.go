@@ -0,0 +1,47 @@
+package cogsfile
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// The executor package registers the executors, which the Cogsfile tests
+// only need by name.
+func init() {
+	for _, name := range []string{"docker", "shell", "podman", "ssh", "exec"} {
+		RegisterExecutor(name, nil)
+	}
+
+	RegisterExecutorPrefix("plugin:", nil)
+}
+
+func TestValidateExecutor(t *testing.T) {
+	RegisterExecutor("strict", func(task Task) error {
+		if task.Image == "" {
+			return errors.New("image is required")
+		}
+
+		return nil
+	})
+
+	t.Run("Should accept registered executors", func(t *testing.T) {
+		assert.Nil(t, ValidateExecutor(Task{Name: "build", Executor: "shell"}))
+		assert.Nil(t, ValidateExecutor(Task{Name: "build", Executor: "plugin:fake"}))
+	})
+
+	t.Run("Should reject unknown executors", func(t *testing.T) {
+		assert.EqualError(t, ValidateExecutor(Task{Name: "build", Executor: "blah"}), "unsupported executor: blah")
+		assert.EqualError(t, ValidateExecutor(Task{Name: "build", Executor: "plugin:"}), "unsupported executor: plugin:")
+	})
+
+	t.Run("Should validate tasks with their executor", func(t *testing.T) {
+		assert.EqualError(t, ValidateExecutor(Task{Name: "build", Executor: "strict"}), "image is required")
+		assert.Nil(t, ValidateExecutor(Task{Name: "build", Executor: "strict", Image: "alpine"}))
+
+		c, err := Load([]byte("tasks:\n  - name: build\n    executor: strict\n"))
+
+		assert.Nil(t, c)
+		assert.EqualError(t, err, "validation failed: validation failed for task: build at 0: image is required")
+	})
+}
@@ -0,0 +1,54 @@
+package cogsfile
+
+import (
+	"regexp"
+	"sort"
+)
+
+// OutputReferencePattern matches ${{ tasks.<task>.outputs.<key> }}, which is
+// replaced with a value the task wrote to its output file.
+var OutputReferencePattern = regexp.MustCompile(`\$\{\{\s*tasks\.([^\s.}]+)\.outputs\.([a-zA-Z_][a-zA-Z0-9_-]*)\s*\}\}`)
+
+type OutputReference struct {
+	Task string
+	Key  string
+}
+
+// OutputReferences returns the outputs of other tasks used by the scripts,
+// environment variables or image of the task.
+func (t Task) OutputReferences() []OutputReference {
+	var references []OutputReference
+
+	for _, value := range t.referencingFields() {
+		for _, match := range OutputReferencePattern.FindAllStringSubmatch(value, -1) {
+			references = append(references, OutputReference{Task: match[1], Key: match[2]})
+		}
+	}
+
+	return references
+}
+
+func (t Task) referencingFields() []string {
+	fields := []string{t.Image}
+
+	for _, script := range []Script{t.BeforeScript, t.Script, t.AfterScript} {
+		for _, command := range script {
+			fields = append(fields, command.Line)
+			fields = append(fields, command.Argv...)
+		}
+	}
+
+	names := make([]string, 0, len(t.EnvVars))
+
+	for name := range t.EnvVars {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fields = append(fields, t.EnvVars[name])
+	}
+
+	return fields
+}
@@ -0,0 +1,88 @@
+package cogsfile
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"regexp"
+)
+
+var envNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Secret is passed to a task as an environment variable and masked in its
+// output. The value is read from a host environment variable, a file or the
+// .cogs/secrets store, which holds a file per secret. Without a source it is
+// read from the host environment variable of the same name.
+type Secret struct {
+	Name  string
+	Env   string
+	File  string
+	Store string
+}
+
+// UnmarshalYAML accepts the name of a secret as a shorthand for reading it
+// from the host environment variable of the same name.
+func (s *Secret) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = Secret{}
+		return value.Decode(&s.Name)
+	}
+
+	type secret Secret
+
+	return value.Decode((*secret)(s))
+}
+
+// Source returns how the value of the secret is read.
+func (s Secret) Source() string {
+	switch {
+	case s.File != "":
+		return "file"
+	case s.Store != "":
+		return "store"
+	default:
+		return "env"
+	}
+}
+
+func validateSecrets(task Task) error {
+	names := map[string]bool{}
+
+	for i, secret := range task.Secrets {
+		if !envNamePattern.MatchString(secret.Name) {
+			return errors.Errorf("invalid secret name at %d: %s", i, secret.Name)
+		}
+
+		if names[secret.Name] {
+			return errors.Errorf("duplicate secret: %s", secret.Name)
+		}
+
+		names[secret.Name] = true
+
+		if _, found := task.EnvVars[secret.Name]; found {
+			return errors.Errorf("secret %s is also set in env_vars", secret.Name)
+		}
+
+		sources := 0
+
+		for _, source := range []string{secret.Env, secret.File, secret.Store} {
+			if source != "" {
+				sources++
+			}
+		}
+
+		if sources > 1 {
+			return errors.Errorf("secret %s must have only one of env, file and store", secret.Name)
+		}
+
+		if secret.Env != "" && !envNamePattern.MatchString(secret.Env) {
+			return errors.Errorf("invalid environment variable for secret %s: %s", secret.Name, secret.Env)
+		}
+
+		// Secrets in the store are files directly in .cogs/secrets.
+		if secret.Store != "" && !NamePattern.MatchString(secret.Store) {
+			return errors.Errorf("invalid store name for secret %s: %s", secret.Name, secret.Store)
+		}
+	}
+
+	return nil
+}
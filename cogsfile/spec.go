@@ -1,32 +1,234 @@
 package cogsfile
 
 import (
+	units "github.com/docker/go-units"
+	"github.com/kinematic-ci/cogs/utils"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 )
 
-const (
-	Docker          = "docker"
-	Shell           = "shell"
-	DefaultFileName = "cogs.yaml"
-)
+const DefaultFileName = "cogs.yaml"
+
+// NamePattern matches names which are used as file or volume names, such as
+// those of tasks, caches and secrets in the store.
+var NamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
 
 type Task struct {
-	Name         string
-	Description  string
-	Executor     string
-	Image        string
-	Shell        string
-	ShellArgs    []string          `yaml:"shell_args"`
-	EnvVars      map[string]string `yaml:"env_vars"`
-	BeforeScript []string          `yaml:"before_script"`
-	Script       []string
-	AfterScript  []string `yaml:"after_script"`
-	DependsOn    []string `yaml:"depends_on"`
+	Name           string
+	Description    string
+	Executor       string
+	Image          string
+	Shell          string
+	ShellArgs      []string          `yaml:"shell_args"`
+	EnvVars        map[string]string `yaml:"env_vars"`
+	EnvFile        EnvFiles          `yaml:"env_file"`
+	Secrets        []Secret
+	BeforeScript   Script `yaml:"before_script"`
+	Script         Script
+	AfterScript    Script   `yaml:"after_script"`
+	DependsOn      []string `yaml:"depends_on"`
+	WorkingDir     string   `yaml:"working_dir"`
+	Timeout        time.Duration
+	Volumes        []Volume
+	Caches         []Cache
+	Resources      Resources
+	NetworkMode    string `yaml:"network_mode"`
+	Privileged     bool
+	CapAdd         []string `yaml:"cap_add"`
+	ExtraHosts     []string `yaml:"extra_hosts"`
+	Platform       string
+	Tty            bool
+	SSH            SSHConfig `yaml:"ssh"`
+	Sandbox        Sandbox
+	Sources        []string
+	Outputs        []string
+	Artifacts      []string
+	NeedsArtifacts []string `yaml:"needs_artifacts"`
+}
+
+// Command is a script command, given either as a command line or as an argv
+// list.
+type Command struct {
+	Line string
+	Argv []string
+}
+
+// String returns the command line, quoting the argv list if needed.
+func (c Command) String() string {
+	if c.Argv != nil {
+		return utils.ShellJoin(c.Argv)
+	}
+
+	return c.Line
+}
+
+// Words returns the argv list, splitting the command line into words.
+func (c Command) Words() ([]string, error) {
+	if c.Argv != nil {
+		return c.Argv, nil
+	}
+
+	return utils.SplitWords(c.Line)
+}
+
+// Script is a list of commands.
+type Script []Command
+
+// Lines returns the command lines of the script, as they are passed to a
+// shell.
+func (s Script) Lines() []string {
+	if s == nil {
+		return nil
+	}
+
+	lines := make([]string, len(s))
+
+	for i, command := range s {
+		lines[i] = command.String()
+	}
+
+	return lines
+}
+
+func (s *Script) UnmarshalYAML(value *yaml.Node) error {
+	if value.Tag == "!!null" {
+		*s = nil
+		return nil
+	}
+
+	if value.Kind != yaml.SequenceNode {
+		return errors.Errorf("line %d: script must be a list of commands", value.Line)
+	}
+
+	script := make(Script, 0, len(value.Content))
+
+	for _, item := range value.Content {
+		if item.Kind == yaml.SequenceNode {
+			var argv []string
+			err := item.Decode(&argv)
+
+			if err != nil {
+				return err
+			}
+
+			if len(argv) == 0 {
+				return errors.Errorf("line %d: argv list must not be empty", item.Line)
+			}
+
+			script = append(script, Command{Argv: argv})
+			continue
+		}
+
+		var command string
+		err := item.Decode(&command)
+
+		if err != nil {
+			return err
+		}
+
+		script = append(script, Command{Line: command})
+	}
+
+	*s = script
+	return nil
+}
+
+// EnvFiles are dotenv files, given as a single file or a list.
+type EnvFiles []string
+
+func (f *EnvFiles) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var file string
+		err := value.Decode(&file)
+
+		if err != nil {
+			return err
+		}
+
+		*f = EnvFiles{file}
+		return nil
+	}
+
+	var files []string
+	err := value.Decode(&files)
+
+	if err != nil {
+		return err
+	}
+
+	*f = files
+	return nil
+}
+
+type Volume struct {
+	Source   string
+	Target   string
+	ReadOnly bool `yaml:"read_only"`
+}
+
+type Cache struct {
+	Name string
+	Path string
+}
+
+type SSHConfig struct {
+	Host                  string
+	Port                  int
+	User                  string
+	Key                   string
+	KnownHosts            string `yaml:"known_hosts"`
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key"`
+	RemoteDir             string `yaml:"remote_dir"`
+}
+
+// Sandbox runs a shell task in Linux namespaces with a read-only root file
+// system. Writable paths are resolved against the working directory.
+type Sandbox struct {
+	Enabled       bool
+	WritablePaths []string `yaml:"writable_paths"`
+	Network       bool
+}
+
+type Resources struct {
+	CPUs   float64 `yaml:"cpus"`
+	Memory string
+	Pids   int64
+}
+
+// MemoryBytes parses a human readable memory limit such as 512m or 2g.
+// An empty limit results in 0, meaning unlimited.
+func (r Resources) MemoryBytes() (int64, error) {
+	if r.Memory == "" {
+		return 0, nil
+	}
+
+	bytes, err := units.RAMInBytes(r.Memory)
+
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid memory limit: %s", r.Memory)
+	}
+
+	return bytes, nil
 }
 
 type Cogsfile struct {
-	Tasks []Task
+	EnvFile EnvFiles `yaml:"env_file"`
+	Tasks   []Task
+}
+
+// Task returns the task with the given name.
+func (c *Cogsfile) Task(name string) (Task, bool) {
+	for _, task := range c.Tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+
+	return Task{}, false
 }
 
 func Load(bytes []byte) (*Cogsfile, error) {
@@ -37,6 +239,15 @@ func Load(bytes []byte) (*Cogsfile, error) {
 		return nil, errors.Wrap(err, "unable to parse yaml")
 	}
 
+	// Tasks read the top level env files before their own, so that theirs
+	// take precedence.
+	if len(cogsfile.EnvFile) > 0 {
+		for i := range cogsfile.Tasks {
+			files := append(EnvFiles{}, cogsfile.EnvFile...)
+			cogsfile.Tasks[i].EnvFile = append(files, cogsfile.Tasks[i].EnvFile...)
+		}
+	}
+
 	err = validate(cogsfile)
 
 	if err != nil {
@@ -54,6 +265,14 @@ func validate(cogsfile *Cogsfile) error {
 	for i, task := range cogsfile.Tasks {
 		err := validateTask(task)
 
+		if err == nil {
+			err = validateNeedsArtifacts(cogsfile, task)
+		}
+
+		if err == nil {
+			err = validateOutputReferences(task)
+		}
+
 		if err != nil {
 			return errors.Wrapf(err, "validation failed for task: %s at %d", task.Name, i)
 		}
@@ -62,18 +281,96 @@ func validate(cogsfile *Cogsfile) error {
 	return nil
 }
 
+func validateNeedsArtifacts(cogsfile *Cogsfile, task Task) error {
+	for _, name := range task.NeedsArtifacts {
+		if !contains(task.DependsOn, name) {
+			return errors.Errorf("needs_artifacts must also be listed in depends_on: %s", name)
+		}
+
+		producer, found := cogsfile.Task(name)
+
+		if found && len(producer.Artifacts) == 0 {
+			return errors.Errorf("task %s does not declare artifacts", name)
+		}
+	}
+
+	return nil
+}
+
+func validateOutputReferences(task Task) error {
+	for _, reference := range task.OutputReferences() {
+		if !contains(task.DependsOn, reference.Task) {
+			return errors.Errorf("outputs of task %s are used but it is not listed in depends_on", reference.Task)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func validateTask(task Task) error {
 	if task.Name == "" {
 		return errors.New("name is required")
 	}
 
-	if task.Executor != Docker && task.Executor != Shell {
-		return errors.Errorf("unsupported executor: %s", task.Executor)
+	if !NamePattern.MatchString(task.Name) {
+		return errors.Errorf("invalid name: %s", task.Name)
 	}
 
-	if task.Executor == Docker && task.Image == "" {
-		return errors.New("image is required for docker executor")
+	if task.Timeout < 0 {
+		return errors.Errorf("timeout must not be negative: %s", task.Timeout)
+	}
+
+	for _, source := range task.Sources {
+		if !isRelativePath(source) {
+			return errors.Errorf("sources must be relative to the working directory: %s", source)
+		}
+	}
+
+	for _, artifact := range task.Artifacts {
+		if !path.IsAbs(artifact) && !isRelativePath(artifact) {
+			return errors.Errorf("artifacts must be absolute or inside the working directory: %s", artifact)
+		}
+	}
+
+	for _, file := range task.EnvFile {
+		if file == "" {
+			return errors.New("env_file must not be empty")
+		}
+	}
+
+	for _, output := range task.Outputs {
+		if !isRelativePath(output) {
+			return errors.Errorf("outputs must be relative to the working directory: %s", output)
+		}
+	}
+
+	err := validateSecrets(task)
+
+	if err != nil {
+		return err
+	}
+
+	err = ValidateExecutor(task)
+
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
+
+func isRelativePath(p string) bool {
+	cleaned := path.Clean(p)
+
+	return p != "" && !path.IsAbs(cleaned) && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
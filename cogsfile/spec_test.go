@@ -3,6 +3,7 @@ package cogsfile
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -31,9 +32,9 @@ tasks:
 				EnvVars: map[string]string{
 					"FOO": "BAR",
 				},
-				BeforeScript: []string{"pwd"},
-				Script:       []string{`python -c 'print("Hello World")'`},
-				AfterScript:  []string{`echo 'Done'`},
+				BeforeScript: Script{{Line: "pwd"}},
+				Script:       Script{{Line: `python -c 'print("Hello World")'`}},
+				AfterScript:  Script{{Line: `echo 'Done'`}},
 			},
 		}}
 
@@ -105,25 +106,400 @@ tasks:
 			err.Error())
 	})
 
-	t.Run("Should return error if image is missing for a task with docker executor", func(t *testing.T) {
+	t.Run("Should load container mounts", func(t *testing.T) {
 		c, err := Load([]byte((
 			`
 tasks:
   - name: build
     executor: docker
-    env_vars:
-      FOO: BAR
+    image: 'docker.io/library/golang:1.14'
+    working_dir: /src
+    volumes:
+      - source: ./testdata
+        target: /testdata
+        read_only: true
+    caches:
+      - name: go-build
+        path: /root/.cache/go-build`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:       "build",
+				Executor:   "docker",
+				Image:      "docker.io/library/golang:1.14",
+				WorkingDir: "/src",
+				Volumes: []Volume{
+					{Source: "./testdata", Target: "/testdata", ReadOnly: true},
+				},
+				Caches: []Cache{
+					{Name: "go-build", Path: "/root/.cache/go-build"},
+				},
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("Should load container runtime options", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    resources:
+      cpus: 1.5
+      memory: 512m
+      pids: 100
+    network_mode: host
+    privileged: true
+    cap_add:
+      - SYS_PTRACE
+    extra_hosts:
+      - 'db:10.0.0.2'
+    platform: linux/arm64`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:        "build",
+				Executor:    "docker",
+				Image:       "docker.io/library/golang:1.14",
+				Resources:   Resources{CPUs: 1.5, Memory: "512m", Pids: 100},
+				NetworkMode: "host",
+				Privileged:  true,
+				CapAdd:      []string{"SYS_PTRACE"},
+				ExtraHosts:  []string{"db:10.0.0.2"},
+				Platform:    "linux/arm64",
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+
+		memory, err := c.Tasks[0].Resources.MemoryBytes()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(512*1024*1024), memory)
+	})
+
+	t.Run("Should load ssh task", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: ssh
+    ssh:
+      host: builder.example.com
+      user: ci
+      key: ~/.ssh/id_ed25519
+      remote_dir: /srv/build
+    outputs:
+      - bin/app
+    script:
+      - make`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:     "build",
+				Executor: "ssh",
+				SSH: SSHConfig{
+					Host:      "builder.example.com",
+					User:      "ci",
+					Key:       "~/.ssh/id_ed25519",
+					RemoteDir: "/srv/build",
+				},
+				Outputs: []string{"bin/app"},
+				Script:  Script{{Line: "make"}},
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("Should return error if output escapes working directory", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+    outputs:
+      - ../bin`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: outputs must be relative to the working directory: ../bin",
+			err.Error())
+	})
+
+	t.Run("Should load argv lists in scripts", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: exec
     before_script:
-      - pwd
     script:
-      - python -c 'print("Hello World")'
-    after_script:
-      - echo 'Done'`)))
+      - [go, build, -ldflags, '-X main.version=1.0', ./...]
+      - go vet ./...`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:     "build",
+				Executor: "exec",
+				Script: Script{
+					{Argv: []string{"go", "build", "-ldflags", "-X main.version=1.0", "./..."}},
+					{Line: "go vet ./..."},
+				},
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("Should return error if script is not a list", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: exec
+    script: go build`)))
 
 		assert.Nil(t, c)
 		assert.NotNil(t, err)
 		assert.Equal(t,
-			"validation failed: validation failed for task: build at 0: image is required for docker executor",
+			"unable to parse yaml: line 5: script must be a list of commands",
 			err.Error())
 	})
+
+	t.Run("Should load sandbox", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+    sandbox:
+      enabled: true
+      writable_paths: [/var/cache/build, out]`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:     "build",
+				Executor: "shell",
+				Sandbox: Sandbox{
+					Enabled:       true,
+					WritablePaths: []string{"/var/cache/build", "out"},
+				},
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("Should load timeout", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+    timeout: 1m30s`)))
+
+		expected := &Cogsfile{Tasks: []Task{
+			{
+				Name:     "build",
+				Executor: "shell",
+				Timeout:  90 * time.Second,
+			},
+		}}
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("Should load artifacts", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+    artifacts: [bin/app, /usr/local/bin/tool]
+  - name: deploy
+    executor: shell
+    depends_on: [build]
+    needs_artifacts: [build]`)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bin/app", "/usr/local/bin/tool"}, c.Tasks[0].Artifacts)
+		assert.Equal(t, []string{"build"}, c.Tasks[1].NeedsArtifacts)
+	})
+
+	t.Run("Should return error if needed artifacts are not a dependency", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+    artifacts: [bin/app]
+  - name: deploy
+    executor: shell
+    needs_artifacts: [build]`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: deploy at 1: needs_artifacts must also be listed in depends_on: build",
+			err.Error())
+	})
+
+	t.Run("Should return error if dependency has no artifacts", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: build
+    executor: shell
+  - name: deploy
+    executor: shell
+    depends_on: [build]
+    needs_artifacts: [build]`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: deploy at 1: task build does not declare artifacts",
+			err.Error())
+	})
+
+	t.Run("Should return output references", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: version
+    executor: shell
+  - name: publish
+    executor: docker
+    image: "app:${{ tasks.version.outputs.tag }}"
+    depends_on: [version]
+    env_vars:
+      TAG: "${{ tasks.version.outputs.tag }}"
+    script:
+      - echo ${{tasks.version.outputs.commit}}`)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []OutputReference{
+			{Task: "version", Key: "tag"},
+			{Task: "version", Key: "commit"},
+			{Task: "version", Key: "tag"},
+		}, c.Tasks[1].OutputReferences())
+	})
+
+	t.Run("Should return error if outputs of a task which is not a dependency are used", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: version
+    executor: shell
+  - name: publish
+    executor: shell
+    script:
+      - echo ${{ tasks.version.outputs.tag }}`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: publish at 1: outputs of task version are used but it is not listed in depends_on",
+			err.Error())
+	})
+
+	t.Run("Should load secrets", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: deploy
+    executor: shell
+    secrets:
+      - GITHUB_TOKEN
+      - name: NPM_TOKEN
+        env: CI_NPM_TOKEN
+      - name: DEPLOY_KEY
+        file: ~/.ssh/deploy_key
+      - name: REGISTRY_PASSWORD
+        store: registry`)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Secret{
+			{Name: "GITHUB_TOKEN"},
+			{Name: "NPM_TOKEN", Env: "CI_NPM_TOKEN"},
+			{Name: "DEPLOY_KEY", File: "~/.ssh/deploy_key"},
+			{Name: "REGISTRY_PASSWORD", Store: "registry"},
+		}, c.Tasks[0].Secrets)
+	})
+
+	t.Run("Should return error if secret has more than one source", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: deploy
+    executor: shell
+    secrets:
+      - name: TOKEN
+        env: CI_TOKEN
+        store: token`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: deploy at 0: secret TOKEN must have only one of env, file and store",
+			err.Error())
+	})
+
+	t.Run("Should return error if secret is also an environment variable", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+tasks:
+  - name: deploy
+    executor: shell
+    env_vars:
+      TOKEN: plain
+    secrets: [TOKEN]`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: deploy at 0: secret TOKEN is also set in env_vars",
+			err.Error())
+	})
+
+	t.Run("Should read top level env files before those of tasks", func(t *testing.T) {
+		c, err := Load([]byte((
+			`
+env_file: .env
+tasks:
+  - name: build
+    executor: shell
+  - name: deploy
+    executor: shell
+    env_file: [deploy.env, .env.local]`)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, EnvFiles{".env"}, c.Tasks[0].EnvFile)
+		assert.Equal(t, EnvFiles{".env", "deploy.env", ".env.local"}, c.Tasks[1].EnvFile)
+	})
+
+	t.Run("Should return error if task name is invalid", func(t *testing.T) {
+		for _, name := range []string{"lint/go", "../escape", ".hidden"} {
+			c, err := Load([]byte((`
+tasks:
+  - name: ` + name + `
+    executor: shell`)))
+
+			assert.Nil(t, c)
+			assert.NotNil(t, err)
+			assert.Equal(t,
+				"validation failed: validation failed for task: "+name+" at 0: invalid name: "+name,
+				err.Error())
+		}
+	})
 }
@@ -0,0 +1,336 @@
+package dotenv
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Lookup returns the value of a variable a dotenv file refers to but doesn't
+// define itself.
+type Lookup func(name string) (string, bool)
+
+// Read parses a dotenv file.
+func Read(file string, lookup Lookup) (map[string]string, error) {
+	f, err := os.Open(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return Parse(f, lookup)
+}
+
+// Parse reads KEY=value lines, optionally prefixed with export. Values may be
+// unquoted, single quoted or double quoted. Blank lines and comments starting
+// with # are skipped, and so are comments after unquoted values when
+// separated by whitespace.
+//
+// $NAME, ${NAME} and ${NAME:-default} in unquoted and double quoted values are
+// expanded, using the variables defined earlier in the file and then lookup.
+// Undefined variables expand to nothing. Double quoted values may span lines
+// and support the escapes \n, \r, \t, \", \\ and \$. Single quoted values are
+// taken literally.
+func Parse(r io.Reader, lookup Lookup) (map[string]string, error) {
+	content, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read env file")
+	}
+
+	p := &parser{input: string(content), line: 1, vars: map[string]string{}, lookup: lookup}
+
+	for {
+		p.skipBlank()
+
+		if p.pos >= len(p.input) {
+			return p.vars, nil
+		}
+
+		err = p.parseVariable()
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", p.line)
+		}
+	}
+}
+
+type parser struct {
+	input  string
+	pos    int
+	line   int
+	vars   map[string]string
+	lookup Lookup
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *parser) advance() byte {
+	c := p.input[p.pos]
+	p.pos++
+
+	if c == '\n' {
+		p.line++
+	}
+
+	return c
+}
+
+// skipBlank skips whitespace, line breaks and comment lines.
+func (p *parser) skipBlank() {
+	for p.pos < len(p.input) {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.advance()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipSpaces() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.advance()
+	}
+}
+
+func (p *parser) skipLine() {
+	for p.pos < len(p.input) && p.peek() != '\n' {
+		p.advance()
+	}
+}
+
+func (p *parser) parseVariable() error {
+	rest := p.input[p.pos:]
+
+	if strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t") {
+		p.pos += len("export")
+		p.skipSpaces()
+	}
+
+	name := p.readName()
+
+	if name == "" {
+		return errors.Errorf("expected variable name, got %q", p.restOfLine())
+	}
+
+	p.skipSpaces()
+
+	if p.peek() != '=' {
+		return errors.Errorf("expected = after %s", name)
+	}
+
+	p.advance()
+	p.skipSpaces()
+
+	var value string
+	var err error
+
+	switch p.peek() {
+	case '\'':
+		value, err = p.readSingleQuoted()
+	case '"':
+		value, err = p.readDoubleQuoted()
+	default:
+		value, err = p.readUnquoted()
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "invalid value of %s", name)
+	}
+
+	p.skipSpaces()
+
+	switch p.peek() {
+	case 0, '\n', '\r':
+	case '#':
+		p.skipLine()
+	default:
+		return errors.Errorf("unexpected %q after value of %s", p.restOfLine(), name)
+	}
+
+	p.vars[name] = value
+
+	return nil
+}
+
+func (p *parser) restOfLine() string {
+	rest := p.input[p.pos:]
+
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+
+	return strings.TrimSpace(rest)
+}
+
+func (p *parser) readName() string {
+	start := p.pos
+
+	for p.pos < len(p.input) && isNameChar(p.peek(), p.pos == start) {
+		p.advance()
+	}
+
+	return p.input[start:p.pos]
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return true
+	case c == '.' || c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+func (p *parser) readSingleQuoted() (string, error) {
+	p.advance()
+	start := p.pos
+
+	for p.pos < len(p.input) {
+		if p.advance() == '\'' {
+			return p.input[start : p.pos-1], nil
+		}
+	}
+
+	return "", errors.New("missing closing '")
+}
+
+func (p *parser) readDoubleQuoted() (string, error) {
+	p.advance()
+	start := p.pos
+
+	for p.pos < len(p.input) {
+		switch p.advance() {
+		case '\\':
+			if p.pos < len(p.input) {
+				p.advance()
+			}
+		case '"':
+			return p.expand(p.input[start:p.pos-1], true)
+		}
+	}
+
+	return "", errors.New(`missing closing "`)
+}
+
+func (p *parser) readUnquoted() (string, error) {
+	start := p.pos
+
+	for p.pos < len(p.input) && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > start && (p.input[p.pos-1] == ' ' || p.input[p.pos-1] == '\t') {
+			break
+		}
+
+		p.advance()
+	}
+
+	return p.expand(strings.TrimRight(p.input[start:p.pos], " \t\r"), false)
+}
+
+// expand replaces variable references in a value, and escapes too in double
+// quoted values.
+func (p *parser) expand(value string, escapes bool) (string, error) {
+	var expanded strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch {
+		case c == '\\' && escapes && i+1 < len(value):
+			i++
+			expanded.WriteString(unescape(value[i]))
+		case c == '$' && i+1 < len(value) && value[i+1] == '{':
+			end := strings.IndexByte(value[i:], '}')
+
+			if end < 0 {
+				return "", errors.New("missing closing }")
+			}
+
+			reference := value[i+2 : i+end]
+			name, fallback, hasFallback := reference, "", false
+
+			if j := strings.Index(reference, ":-"); j >= 0 {
+				name, fallback, hasFallback = reference[:j], reference[j+2:], true
+			}
+
+			if !isName(name) {
+				return "", errors.Errorf("invalid variable reference: ${%s}", reference)
+			}
+
+			resolved := p.value(name)
+
+			if resolved == "" && hasFallback {
+				resolved = fallback
+			}
+
+			expanded.WriteString(resolved)
+			i += end
+		case c == '$' && i+1 < len(value) && isNameChar(value[i+1], true):
+			end := i + 1
+
+			for end < len(value) && isNameChar(value[end], false) && value[end] != '.' {
+				end++
+			}
+
+			expanded.WriteString(p.value(value[i+1 : end]))
+			i = end - 1
+		default:
+			expanded.WriteByte(c)
+		}
+	}
+
+	return expanded.String(), nil
+}
+
+func (p *parser) value(name string) string {
+	if value, found := p.vars[name]; found {
+		return value
+	}
+
+	if p.lookup != nil {
+		value, _ := p.lookup(name)
+		return value
+	}
+
+	return ""
+}
+
+func isName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case '"', '\\', '$':
+		return string(c)
+	default:
+		return "\\" + string(c)
+	}
+}
@@ -0,0 +1,76 @@
+package dotenv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "HOME" {
+			return "/home/cogs", true
+		}
+
+		return "", false
+	}
+
+	t.Run("Should parse variables", func(t *testing.T) {
+		vars, err := Parse(strings.NewReader(`
+# database
+DB_HOST=localhost
+export DB_PORT = 5432   # default port
+DB_NAME=app#1
+
+EMPTY=
+SINGLE='$HOME stays \n literal'
+DOUBLE="tab\there \"quoted\" \$HOME"
+MULTI="first
+second"
+`), lookup)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"DB_HOST": "localhost",
+			"DB_PORT": "5432",
+			"DB_NAME": "app#1",
+			"EMPTY":   "",
+			"SINGLE":  `$HOME stays \n literal`,
+			"DOUBLE":  "tab\there \"quoted\" $HOME",
+			"MULTI":   "first\nsecond",
+		}, vars)
+	})
+
+	t.Run("Should expand variables", func(t *testing.T) {
+		vars, err := Parse(strings.NewReader(`
+HOST=db
+URL=postgres://$HOST:${PORT:-5432}/app
+CACHE="${HOME}/.cache"
+MISSING=[$UNDEFINED]
+PRICE=5$
+`), lookup)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{
+			"HOST":    "db",
+			"URL":     "postgres://db:5432/app",
+			"CACHE":   "/home/cogs/.cache",
+			"MISSING": "[]",
+			"PRICE":   "5$",
+		}, vars)
+	})
+
+	t.Run("Should return error for invalid lines", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("A=1\nnot a variable\n"), lookup)
+		assert.EqualError(t, err, "line 2: expected = after not")
+
+		_, err = Parse(strings.NewReader("A=1\n=2\n"), lookup)
+		assert.EqualError(t, err, `line 2: expected variable name, got "=2"`)
+
+		_, err = Parse(strings.NewReader("A=\"open\nB=2\n"), lookup)
+		assert.EqualError(t, err, `line 3: invalid value of A: missing closing "`)
+
+		_, err = Parse(strings.NewReader("A='quoted' trailing\n"), lookup)
+		assert.EqualError(t, err, `line 1: unexpected "trailing" after value of A`)
+	})
+}
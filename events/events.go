@@ -0,0 +1,131 @@
+package events
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	RunStarted           Type = "run_started"
+	RunFinished          Type = "run_finished"
+	TaskPlanned          Type = "task_planned"
+	TaskStarted          Type = "task_started"
+	TaskSkipped          Type = "task_skipped"
+	TaskFinished         Type = "task_finished"
+	PhaseStarted         Type = "phase_started"
+	PhaseFinished        Type = "phase_finished"
+	Output               Type = "output"
+	ExecutorCreated      Type = "executor_created"
+	ExecutorStepStarted  Type = "executor_step_started"
+	ExecutorStepFinished Type = "executor_step_finished"
+	ExecutorClosed       Type = "executor_closed"
+)
+
+// Phases of a task.
+const (
+	BeforeScript = "before_script"
+	Script       = "script"
+	AfterScript  = "after_script"
+)
+
+// Steps executors take before scripts can run.
+const (
+	ImagePull      = "image_pull"
+	ContainerStart = "container_start"
+	Connect        = "connect"
+	Sync           = "sync"
+)
+
+// Event describes something that happened during a run. Only the fields
+// relevant to its type are set.
+type Event struct {
+	Type        Type      `json:"type"`
+	Time        time.Time `json:"time"`
+	Run         string    `json:"run,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Tasks       []string  `json:"tasks,omitempty"`
+	Task        string    `json:"task,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Phase       string    `json:"phase,omitempty"`
+	Executor    string    `json:"executor,omitempty"`
+	Step        string    `json:"step,omitempty"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Data        string    `json:"data,omitempty"`
+}
+
+// WithExitCode returns the event with its exit code set.
+func (e Event) WithExitCode(exitCode int) Event {
+	e.ExitCode = &exitCode
+	return e
+}
+
+// WithError returns the event with the error message set, if there is one.
+func (e Event) WithError(err error) Event {
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	return e
+}
+
+type Handler func(event Event)
+
+// Bus hands published events to every subscribed handler, one event at a
+// time. A nil bus discards events, so code publishing events doesn't need to
+// check whether anyone listens.
+type Bus struct {
+	mutex    sync.Mutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish sets the time of the event unless it is set already and hands it
+// to the handlers.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
+
+// OutputWriter publishes everything written to it as output of a task phase.
+func (b *Bus) OutputWriter(task, phase string) io.Writer {
+	return &outputWriter{bus: b, task: task, phase: phase}
+}
+
+type outputWriter struct {
+	bus   *Bus
+	task  string
+	phase string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.bus.Publish(Event{Type: Output, Task: w.task, Phase: w.phase, Data: string(p)})
+
+	return len(p), nil
+}
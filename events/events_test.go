@@ -0,0 +1,61 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Should hand events to every handler", func(t *testing.T) {
+		bus := NewBus()
+		var first, second []Event
+
+		bus.Subscribe(func(event Event) { first = append(first, event) })
+		bus.Subscribe(func(event Event) { second = append(second, event) })
+
+		bus.Publish(Event{Type: TaskStarted, Task: "build"})
+
+		assert.Len(t, first, 1)
+		assert.Equal(t, first, second)
+		assert.Equal(t, "build", first[0].Task)
+		assert.False(t, first[0].Time.IsZero())
+	})
+
+	t.Run("Should publish output", func(t *testing.T) {
+		bus := NewBus()
+		var published []Event
+
+		bus.Subscribe(func(event Event) { published = append(published, event) })
+
+		_, err := fmt.Fprint(bus.OutputWriter("build", Script), "+ go build\n")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Event{{Type: Output, Time: published[0].Time, Task: "build", Phase: Script, Data: "+ go build\n"}}, published)
+	})
+
+	t.Run("Should discard events without a bus", func(t *testing.T) {
+		var bus *Bus
+
+		bus.Publish(Event{Type: RunStarted})
+	})
+}
+
+func TestJSONHandler(t *testing.T) {
+	t.Run("Should write one event per line", func(t *testing.T) {
+		var output bytes.Buffer
+		handler := JSONHandler(&output)
+		at := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		handler(Event{Type: PhaseFinished, Time: at, Task: "build", Phase: Script}.WithExitCode(0))
+		handler(Event{Type: TaskFinished, Time: at, Task: "build"}.WithError(errors.New("script failed")))
+
+		assert.Equal(t,
+			`{"type":"phase_finished","time":"2020-10-01T12:00:00Z","task":"build","phase":"script","exit_code":0}`+"\n"+
+				`{"type":"task_finished","time":"2020-10-01T12:00:00Z","task":"build","error":"script failed"}`+"\n",
+			output.String())
+	})
+}
@@ -0,0 +1,20 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// JSONHandler writes every event as a line of JSON.
+func JSONHandler(w io.Writer) Handler {
+	encoder := json.NewEncoder(w)
+
+	return func(event Event) {
+		err := encoder.Encode(event)
+
+		if err != nil {
+			log.Println("Unable to write event", err)
+		}
+	}
+}
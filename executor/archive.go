@@ -0,0 +1,205 @@
+package executor
+
+import (
+	"archive/tar"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeTar writes the contents of root as a tar stream, skipping the
+// top-level entries listed in exclude.
+func writeTar(w io.Writer, root string, exclude []string) error {
+	archive := tar.NewWriter(w)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(root, path)
+
+		if err != nil || name == "." {
+			return err
+		}
+
+		for _, excluded := range exclude {
+			if name == excluded {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		return addToTar(archive, path, filepath.ToSlash(name), info)
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "unable to archive directory")
+	}
+
+	return archive.Close()
+}
+
+func addToTar(archive *tar.Writer, path, name string, info os.FileInfo) error {
+	link := ""
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+
+		if err != nil {
+			return err
+		}
+
+		link = target
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+
+	err = archive.WriteHeader(header)
+
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(archive, file)
+
+	return err
+}
+
+// extractTar unpacks a tar stream into dst, refusing entries which would
+// end up outside of it, either through their name or through a symbolic link
+// extracted earlier.
+func extractTar(r io.Reader, dst string) error {
+	archive := tar.NewReader(r)
+
+	for {
+		header, err := archive.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "unable to read archive")
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("archive entry outside of destination: %s", header.Name)
+		}
+
+		err = checkParents(dst, name)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to extract %s", header.Name)
+		}
+
+		target := filepath.Join(dst, name)
+
+		err = extractEntry(archive, header, target)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to extract %s", header.Name)
+		}
+	}
+}
+
+// checkParents returns an error if a directory between dst and name is a
+// symbolic link.
+func checkParents(dst, name string) error {
+	dir := dst
+
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("%s is a symbolic link", dir)
+		}
+	}
+
+	return nil
+}
+
+func extractEntry(archive *tar.Reader, header *tar.Header, target string) error {
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, mode|0700)
+	case tar.TypeSymlink:
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+
+		if err != nil {
+			return err
+		}
+
+		_ = os.Remove(target)
+
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeReg:
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+
+		if err != nil {
+			return err
+		}
+
+		// Replace rather than follow a symbolic link in place of the file.
+		info, err := os.Lstat(target)
+
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = os.Remove(target)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, archive)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Should extract what was archived", func(t *testing.T) {
+		src := filepath.Join(dir, "src")
+		require.Nil(t, os.MkdirAll(filepath.Join(src, "bin"), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(src, "bin", "app"), []byte("app"), 0755))
+		require.Nil(t, os.Symlink("app", filepath.Join(src, "bin", "latest")))
+
+		var buffer bytes.Buffer
+		require.Nil(t, writeTar(&buffer, src, nil))
+
+		dst := filepath.Join(dir, "dst")
+		require.Nil(t, extractTar(&buffer, dst))
+
+		content, err := ioutil.ReadFile(filepath.Join(dst, "bin", "latest"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "app", string(content))
+	})
+
+	t.Run("Should not extract files through symbolic links", func(t *testing.T) {
+		outside := filepath.Join(dir, "outside")
+		require.Nil(t, os.MkdirAll(outside, 0755))
+
+		var buffer bytes.Buffer
+		archive := tar.NewWriter(&buffer)
+		require.Nil(t, archive.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "escape", Linkname: outside}))
+		require.Nil(t, archive.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "escape/pwned", Mode: 0644, Size: 5}))
+		_, err := archive.Write([]byte("pwned"))
+		require.Nil(t, err)
+		require.Nil(t, archive.Close())
+
+		err = extractTar(&buffer, filepath.Join(dir, "evil"))
+
+		assert.NotNil(t, err)
+		assert.NoFileExists(t, filepath.Join(outside, "pwned"))
+	})
+}
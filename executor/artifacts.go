@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"context"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"path/filepath"
+)
+
+// StateDir holds files cogs keeps per working directory, such as the artifact
+// store. It is never copied into task environments.
+const StateDir = ".cogs"
+
+// ArtifactSource is implemented by executors whose files are not all visible
+// in the working directory on the host, such as containers and remote hosts.
+type ArtifactSource interface {
+	// CopyArtifact copies a file or directory from the task environment into
+	// dst. See ArtifactPath for where it ends up.
+	CopyArtifact(ctx context.Context, path, dst string) error
+}
+
+// ArtifactPath splits an artifact path into the directory it is copied from
+// and its base name. Artifacts relative to the working directory keep their
+// location below the artifact store, absolute ones are stored under their
+// base name.
+func ArtifactPath(path string) (parent, name, storeDir string) {
+	parent, name = filepath.Split(filepath.Clean(filepath.FromSlash(path)))
+
+	if filepath.IsAbs(path) {
+		return parent, name, ""
+	}
+
+	return parent, name, parent
+}
+
+// CopyArtifact copies an artifact of a task into dst. Executors which are not
+// an ArtifactSource, or no executor at all, copy from the host.
+func CopyArtifact(ctx context.Context, e Executor, workingDirectory, path, dst string) error {
+	if source, ok := e.(ArtifactSource); ok {
+		return source.CopyArtifact(ctx, path, dst)
+	}
+
+	src := path
+
+	if !filepath.IsAbs(path) {
+		src = filepath.Join(workingDirectory, filepath.FromSlash(path))
+	}
+
+	_, name, storeDir := ArtifactPath(path)
+
+	err := utils.CopyTree(src, filepath.Join(dst, storeDir, name))
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to copy artifact %s", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-artifacts")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	workingDirectory := filepath.Join(dir, "work")
+	require.Nil(t, os.MkdirAll(filepath.Join(workingDirectory, "bin"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(workingDirectory, "bin", "app"), []byte("app"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "tool"), []byte("tool"), 0644))
+
+	store := filepath.Join(dir, "store")
+
+	t.Run("Should keep relative artifacts at their location", func(t *testing.T) {
+		assert.Nil(t, CopyArtifact(context.Background(), nil, workingDirectory, "bin/app", store))
+
+		info, err := os.Stat(filepath.Join(store, "bin", "app"))
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	})
+
+	t.Run("Should store absolute artifacts under their base name", func(t *testing.T) {
+		assert.Nil(t, CopyArtifact(context.Background(), NewShellExecutor(workingDirectory, "/bin/sh", nil), workingDirectory, filepath.Join(dir, "tool"), store))
+		assert.FileExists(t, filepath.Join(store, "tool"))
+	})
+
+	t.Run("Should return error if artifact is missing", func(t *testing.T) {
+		assert.NotNil(t, CopyArtifact(context.Background(), nil, workingDirectory, "missing", store))
+	})
+}
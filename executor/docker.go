@@ -9,35 +9,209 @@ import (
 	"github.com/docker/docker/api/types/network"
 	docker "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/pkg/term"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
 	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	perpetualCommand = "sleep"
-	defaultTimeout   = "3600"
-	ciWorkingDir     = "/ci"
-	fallbackUserId   = "0"
+	perpetualCommand  = "sleep"
+	defaultTimeout    = "3600"
+	ciWorkingDir      = "/ci"
+	fallbackUserId    = "0"
+	cacheVolumePrefix = "cogs-cache-"
+	killTimeout       = 10 * time.Second
 )
 
+var (
+	platformPattern = regexp.MustCompile(`^[a-z0-9]+(/[a-z0-9]+(/[a-z0-9]+)?)?$`)
+	// Network modes are bridge, host, none, container:<name> or the name of
+	// a user-defined network.
+	networkModePattern = regexp.MustCompile(`^(container:)?[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	capabilityPattern  = regexp.MustCompile(`^(?i)(cap_)?[a-z][a-z0-9_]*$`)
+)
+
+type Volume struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+type Cache struct {
+	Name string
+	Path string
+}
+
+type ContainerOptions struct {
+	WorkingDir  string
+	Volumes     []Volume
+	Caches      []Cache
+	CPUs        float64
+	Memory      int64
+	PidsLimit   int64
+	NetworkMode string
+	Privileged  bool
+	CapAdd      []string
+	ExtraHosts  []string
+	Platform    string
+	Tty         bool
+}
+
+func init() {
+	Register(Docker, func(c Config) (Executor, error) {
+		e := NewDockerExecutor(c.Task, c.Image, c.WorkingDirectory, c.Shell, c.ShellArgs, c.Container, c.Docker)
+		e.useEnvironment(c)
+		e.events = c.Events
+
+		if c.Pool != nil {
+			e.UsePool(c.Pool)
+		}
+
+		return e, nil
+	}, noSandbox(validateContainer))
+}
+
+func validateContainer(task cogsfile.Task) error {
+	if task.Image == "" {
+		return errors.Errorf("image is required for %s executor", task.Executor)
+	}
+
+	if task.WorkingDir != "" && !path.IsAbs(task.WorkingDir) {
+		return errors.Errorf("working_dir must be an absolute path: %s", task.WorkingDir)
+	}
+
+	for i, volume := range task.Volumes {
+		err := validateVolume(volume)
+
+		if err != nil {
+			return errors.Wrapf(err, "invalid volume at %d", i)
+		}
+	}
+
+	for i, cache := range task.Caches {
+		err := validateCache(cache)
+
+		if err != nil {
+			return errors.Wrapf(err, "invalid cache at %d", i)
+		}
+	}
+
+	return validateContainerRuntime(task)
+}
+
+func validateContainerRuntime(task cogsfile.Task) error {
+	if task.Resources.CPUs < 0 {
+		return errors.Errorf("resources.cpus must not be negative: %g", task.Resources.CPUs)
+	}
+
+	if task.Resources.Pids < 0 {
+		return errors.Errorf("resources.pids must not be negative: %d", task.Resources.Pids)
+	}
+
+	memory, err := task.Resources.MemoryBytes()
+
+	if err != nil {
+		return errors.Wrap(err, "invalid resources")
+	}
+
+	if memory < 0 {
+		return errors.Errorf("resources.memory must not be negative: %s", task.Resources.Memory)
+	}
+
+	for _, host := range task.ExtraHosts {
+		parts := strings.SplitN(host, ":", 2)
+
+		if len(parts) != 2 || parts[0] == "" || net.ParseIP(parts[1]) == nil {
+			return errors.Errorf("invalid extra host, expected host:ip: %s", host)
+		}
+	}
+
+	if task.NetworkMode != "" && !networkModePattern.MatchString(task.NetworkMode) {
+		return errors.Errorf("invalid network_mode: %s", task.NetworkMode)
+	}
+
+	for _, capability := range task.CapAdd {
+		if !capabilityPattern.MatchString(capability) {
+			return errors.Errorf("invalid capability in cap_add: %s", capability)
+		}
+	}
+
+	if task.Platform != "" && !platformPattern.MatchString(task.Platform) {
+		return errors.Errorf("invalid platform, expected os[/arch[/variant]]: %s", task.Platform)
+	}
+
+	return nil
+}
+
+func validateVolume(volume cogsfile.Volume) error {
+	if volume.Source == "" {
+		return errors.New("source is required")
+	}
+
+	if !path.IsAbs(volume.Target) {
+		return errors.Errorf("target must be an absolute path: %s", volume.Target)
+	}
+
+	return nil
+}
+
+func validateCache(cache cogsfile.Cache) error {
+	if !cogsfile.NamePattern.MatchString(cache.Name) {
+		return errors.Errorf("invalid name: %s", cache.Name)
+	}
+
+	if !path.IsAbs(cache.Path) {
+		return errors.Errorf("path must be an absolute path: %s", cache.Path)
+	}
+
+	return nil
+}
+
 type dockerSession struct {
+	ctx      context.Context
 	client   *docker.Client
 	response types.HijackedResponse
 	execID   string
+	output   io.Reader
+	stop     func()
 }
 
-func newSession(execID string, response types.HijackedResponse, client *docker.Client) *dockerSession {
-	return &dockerSession{client, response, execID}
+func newSession(ctx context.Context, execID string, response types.HijackedResponse, executor *DockerExecutor) *dockerSession {
+	reader, writer := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, response.Reader)
+		writer.CloseWithError(err)
+	}()
+
+	return &dockerSession{
+		ctx:      ctx,
+		client:   executor.client,
+		response: response,
+		execID:   execID,
+		output:   reader,
+		stop:     executor.interruptOnDone(ctx, response),
+	}
 }
 
 func (s *dockerSession) Reader() io.Reader {
-	return s.response.Reader
+	return s.output
 }
 
 func (s *dockerSession) Writer() io.Writer {
@@ -54,6 +228,12 @@ func (s *dockerSession) CloseWrite() error {
 }
 
 func (s *dockerSession) End(ctx context.Context) (int, error) {
+	s.stop()
+
+	if s.ctx.Err() != nil {
+		return -1, errors.Wrap(s.ctx.Err(), "error while waiting for commands to end")
+	}
+
 	result, err := s.client.ContainerExecInspect(ctx, s.execID)
 
 	if err != nil {
@@ -64,6 +244,8 @@ func (s *dockerSession) End(ctx context.Context) (int, error) {
 }
 
 type DockerExecutor struct {
+	name             string
+	user             string
 	client           *docker.Client
 	image            string
 	containerID      string
@@ -71,63 +253,191 @@ type DockerExecutor struct {
 	workingDirectory string
 	shell            string
 	shellArgs        []string
+	options          ContainerOptions
+	env              []string
+	events           *events.Bus
+	pool             *ContainerPool
+	poolKey          string
+	ownsClient       bool
 }
 
-func NewDockerExecutor(name, image, workingDirectory, shell string, args []string, client *docker.Client) *DockerExecutor {
+func NewDockerExecutor(name, image, workingDirectory, shell string, args []string, options ContainerOptions, client *docker.Client) *DockerExecutor {
 	return &DockerExecutor{
+		name:             "docker",
+		user:             userId(),
 		client:           client,
 		image:            image,
 		task:             name,
 		shell:            shell,
 		shellArgs:        args,
 		workingDirectory: workingDirectory,
+		options:          options,
 	}
 }
 
 func (e *DockerExecutor) Name() string {
-	return "docker"
+	return e.name
+}
+
+// UsePool makes the executor take containers from the pool and hand them
+// back on Close instead of stopping them.
+func (e *DockerExecutor) UsePool(pool *ContainerPool) {
+	e.pool = pool
+}
+
+// useEnvironment passes the task variables to every command run in the
+// container. The working directory is mounted, so the output file is found
+// relative to its path inside the container.
+func (e *DockerExecutor) useEnvironment(c Config) {
+	e.env = c.environment(path.Join(e.containerWorkingDir(), filepath.ToSlash(c.OutputFile)))
 }
 
 func (e *DockerExecutor) startContainer(ctx context.Context) error {
-	err := pullImage(ctx, e.image, e.client)
+	config := &container.Config{
+		User:       e.user,
+		Image:      e.image,
+		WorkingDir: e.containerWorkingDir(),
+		Cmd:        []string{perpetualCommand, defaultTimeout},
+	}
+	hostConfig := e.hostConfig()
+
+	if e.pool != nil {
+		key, err := poolKey(config, hostConfig, e.options.Platform)
+
+		if err != nil {
+			return errors.Wrap(err, "cannot determine pool key")
+		}
+
+		e.poolKey = key
+
+		if containerID, found := e.pool.acquire(key); found {
+			log.Printf("Reusing container %.12s\n", containerID)
+			e.containerID = containerID
+			return nil
+		}
+	}
+
+	err := publishStep(e.events, e.task, e.name, events.ImagePull, func() error {
+		return pullImage(ctx, e.image, e.options.Platform, e.client)
+	})
 
 	if err != nil {
 		return errors.Wrap(err, "cannot pull docker image")
 	}
 
+	if e.options.Platform != "" {
+		// The create call can't select a platform, so the container is created
+		// from the ID of the image just pulled rather than from its tag, which
+		// may point to another platform.
+		imageID, err := platformImage(ctx, e.client, e.image, e.options.Platform)
+
+		if err != nil {
+			return err
+		}
+
+		config.Image = imageID
+	}
+
+	var containerID string
+
+	err = publishStep(e.events, e.task, e.name, events.ContainerStart, func() error {
+		containerID, err = e.createContainer(ctx, config, hostConfig)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if e.pool != nil {
+		e.pool.track(containerID)
+	}
+
+	e.containerID = containerID
+	return nil
+}
+
+func (e *DockerExecutor) createContainer(ctx context.Context, config *container.Config, hostConfig *container.HostConfig) (string, error) {
 	containerName := fmt.Sprintf("%s-%d", e.task, time.Now().Unix())
 
-	createdContainer, err := e.client.ContainerCreate(ctx,
-		&container.Config{
-			User:       userId(),
-			Image:      e.image,
-			WorkingDir: ciWorkingDir,
-			Cmd:        []string{perpetualCommand, defaultTimeout},
-		},
-		&container.HostConfig{
-			Mounts: []mount.Mount{
-				{
-					Type:     mount.TypeBind,
-					Source:   e.workingDirectory,
-					Target:   ciWorkingDir,
-					ReadOnly: false,
-				},
-			},
-		},
+	createdContainer, err := e.client.ContainerCreate(ctx, config, hostConfig,
 		&network.NetworkingConfig{}, containerName)
 
 	if err != nil {
-		return errors.Wrap(err, "error creating container")
+		return "", errors.Wrap(err, "error creating container")
 	}
 
 	err = e.client.ContainerStart(ctx, createdContainer.ID, types.ContainerStartOptions{})
 
 	if err != nil {
-		return errors.Wrap(err, "error starting container")
+		return "", errors.Wrap(err, "error starting container")
 	}
 
-	e.containerID = createdContainer.ID
-	return nil
+	return createdContainer.ID, nil
+}
+
+func (e *DockerExecutor) containerWorkingDir() string {
+	if e.options.WorkingDir != "" {
+		return e.options.WorkingDir
+	}
+
+	return ciWorkingDir
+}
+
+func (e *DockerExecutor) hostConfig() *container.HostConfig {
+	hostConfig := &container.HostConfig{
+		Mounts:      e.mounts(),
+		NetworkMode: container.NetworkMode(e.options.NetworkMode),
+		Privileged:  e.options.Privileged,
+		CapAdd:      e.options.CapAdd,
+		ExtraHosts:  e.options.ExtraHosts,
+	}
+
+	hostConfig.NanoCPUs = int64(e.options.CPUs * 1e9)
+	hostConfig.Memory = e.options.Memory
+
+	if e.options.PidsLimit > 0 {
+		pidsLimit := e.options.PidsLimit
+		hostConfig.PidsLimit = &pidsLimit
+	}
+
+	return hostConfig
+}
+
+func (e *DockerExecutor) mounts() []mount.Mount {
+	mounts := []mount.Mount{
+		{
+			Type:     mount.TypeBind,
+			Source:   e.workingDirectory,
+			Target:   e.containerWorkingDir(),
+			ReadOnly: false,
+		},
+	}
+
+	for _, volume := range e.options.Volumes {
+		source := volume.Source
+
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(e.workingDirectory, source)
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   source,
+			Target:   volume.Target,
+			ReadOnly: volume.ReadOnly,
+		})
+	}
+
+	for _, cache := range e.options.Caches {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: cacheVolumePrefix + cache.Name,
+			Target: cache.Path,
+		})
+	}
+
+	return mounts
 }
 
 func (e *DockerExecutor) Session(ctx context.Context) (Session, error) {
@@ -139,28 +449,142 @@ func (e *DockerExecutor) Session(ctx context.Context) (Session, error) {
 		}
 	}
 
-	cmd := makeCommand(e.shell, e.shellArgs)
+	if e.options.Tty {
+		return newDockerTtySession(ctx, e), nil
+	}
+
+	execID, response, err := e.exec(ctx, makeCommand(e.shell, e.shellArgs), false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSession(ctx, execID, response, e), nil
+}
+
+// interruptOnDone kills the processes of the container and closes the
+// connection to an exec once ctx is done, which ends its output. The
+// container keeps running so that it can be reused. The returned function
+// stops watching ctx.
+func (e *DockerExecutor) interruptOnDone(ctx context.Context, response types.HijackedResponse) func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.killProcesses()
+			response.Close()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
 
+// killProcesses kills every process in the container except its init
+// process, which keeps the container running.
+func (e *DockerExecutor) killProcesses() {
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+
+	_, response, err := e.exec(ctx, append(makeCommand(e.shell, e.shellArgs), "-c", "kill -KILL -1"), false)
+
+	if err != nil {
+		log.Println("Unable to kill processes in container", err)
+		return
+	}
+
+	defer response.Close()
+
+	_ = response.CloseWrite()
+	_, _ = io.Copy(ioutil.Discard, response.Reader)
+}
+
+func (e *DockerExecutor) exec(ctx context.Context, cmd []string, tty bool) (string, types.HijackedResponse, error) {
 	execConfig := types.ExecConfig{
-		User:         userId(),
-		Privileged:   false,
-		Tty:          false,
+		User:         e.user,
+		Privileged:   e.options.Privileged,
+		Tty:          tty,
 		AttachStdin:  true,
 		AttachStderr: true,
 		AttachStdout: true,
-		Env:          nil,
+		Env:          e.env,
 		Cmd:          cmd,
 	}
 
 	execCreated, err := e.client.ContainerExecCreate(ctx, e.containerID, execConfig)
 
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot execute command inside container")
+		return "", types.HijackedResponse{}, errors.Wrap(err, "cannot execute command inside container")
+	}
+
+	execResponse, err := e.client.ContainerExecAttach(ctx, execCreated.ID, types.ExecStartCheck{Tty: tty})
+
+	if err != nil {
+		return "", types.HijackedResponse{}, errors.Wrap(err, "cannot attach to command inside container")
+	}
+
+	return execCreated.ID, execResponse, nil
+}
+
+func (e *DockerExecutor) resizeExec(ctx context.Context, execID string) func(size *term.Winsize) {
+	return func(size *term.Winsize) {
+		_ = e.client.ContainerExecResize(ctx, execID, types.ResizeOptions{
+			Height: uint(size.Height),
+			Width:  uint(size.Width),
+		})
+	}
+}
+
+func (e *DockerExecutor) Interactive(ctx context.Context) error {
+	if e.containerID == "" {
+		err := e.startContainer(ctx)
+
+		if err != nil {
+			return errors.Wrap(err, "error starting container")
+		}
+	}
+
+	execID, response, err := e.exec(ctx, []string{e.shell}, true)
+
+	if err != nil {
+		return errors.Wrap(err, "cannot open shell")
+	}
+
+	defer response.Close()
+
+	inFd, isTerminal := term.GetFdInfo(os.Stdin)
+
+	if isTerminal {
+		state, err := term.SetRawTerminal(inFd)
+
+		if err != nil {
+			return errors.Wrap(err, "cannot set terminal to raw mode")
+		}
+
+		defer term.RestoreTerminal(inFd, state)
 	}
 
-	execResponse, err := e.client.ContainerExecAttach(ctx, execCreated.ID, types.ExecStartCheck{})
+	stopResize := watchTerminalSize(e.resizeExec(ctx, execID))
+	defer stopResize()
+
+	stopInput := copyStdin(response.Conn)
+
+	_, err = io.Copy(os.Stdout, response.Reader)
+
+	// The connection is closed first so that a pending write of input
+	// fails instead of blocking the copy from stopping.
+	response.Close()
+	stopInput()
+
+	if err != nil {
+		return errors.Wrap(err, "error reading from shell")
+	}
 
-	return newSession(execCreated.ID, execResponse, e.client), nil
+	return nil
 }
 
 func makeCommand(shell string, args []string) []string {
@@ -174,12 +598,24 @@ func makeCommand(shell string, args []string) []string {
 }
 
 func (e *DockerExecutor) Close(ctx context.Context) error {
-	log.Println("Stopping containers")
+	// A client created for the executor alone is closed along with it.
+	if e.ownsClient {
+		defer e.client.Close()
+	}
 
 	if e.containerID == "" {
 		return nil
 	}
 
+	if e.pool != nil {
+		log.Println("Returning container to pool")
+		e.pool.release(e.poolKey, e.containerID)
+		e.containerID = ""
+		return nil
+	}
+
+	log.Println("Stopping containers")
+
 	timeout := 1 * time.Second
 	err := e.client.ContainerStop(ctx, e.containerID, &timeout)
 
@@ -190,8 +626,40 @@ func (e *DockerExecutor) Close(ctx context.Context) error {
 	return nil
 }
 
-func pullImage(ctx context.Context, image string, client *docker.Client) error {
-	res, err := client.ImagePull(ctx, image, types.ImagePullOptions{})
+// CopyArtifact copies a file or directory out of the container. Relative
+// paths are resolved against the container working directory.
+func (e *DockerExecutor) CopyArtifact(ctx context.Context, path, dst string) error {
+	if e.containerID == "" {
+		return errors.New("container is not running")
+	}
+
+	containerPath := path
+
+	if !filepath.IsAbs(path) {
+		containerPath = e.containerWorkingDir() + "/" + filepath.ToSlash(path)
+	}
+
+	content, _, err := e.client.CopyFromContainer(ctx, e.containerID, containerPath)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to copy artifact %s from container", path)
+	}
+
+	defer content.Close()
+
+	_, _, storeDir := ArtifactPath(path)
+
+	err = extractTar(content, filepath.Join(dst, storeDir))
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to extract artifact %s", path)
+	}
+
+	return nil
+}
+
+func pullImage(ctx context.Context, image, platform string, client *docker.Client) error {
+	res, err := client.ImagePull(ctx, image, types.ImagePullOptions{Platform: platform})
 
 	if err != nil {
 		return errors.Wrap(err, "cannot pull image from registry")
@@ -206,6 +674,33 @@ func pullImage(ctx context.Context, image string, client *docker.Client) error {
 	return nil
 }
 
+func platformImage(ctx context.Context, client *docker.Client, image, platform string) (string, error) {
+	inspect, _, err := client.ImageInspectWithRaw(ctx, image)
+
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot inspect image %s", image)
+	}
+
+	if !matchesPlatform(inspect.Os, inspect.Architecture, platform) {
+		return "", errors.Errorf("image %s is for %s/%s, not %s", image, inspect.Os, inspect.Architecture, platform)
+	}
+
+	return inspect.ID, nil
+}
+
+// matchesPlatform compares the os and architecture of an image with a platform
+// in the os[/arch[/variant]] form. Without an architecture only the os is
+// compared, and the variant isn't reported by the daemon.
+func matchesPlatform(goos, arch, platform string) bool {
+	parts := strings.Split(platform, "/")
+
+	if parts[0] != goos {
+		return false
+	}
+
+	return len(parts) < 2 || parts[1] == arch
+}
+
 func userId() string {
 	if runtime.GOOS == "linux" {
 		userInfo, err := user.Current()
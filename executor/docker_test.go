@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateContainer(t *testing.T) {
+	t.Run("Should return error if image is missing for a task with docker executor", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    env_vars:
+      FOO: BAR
+    before_script:
+      - pwd
+    script:
+      - python -c 'print("Hello World")'
+    after_script:
+      - echo 'Done'`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: image is required for docker executor",
+			err.Error())
+	})
+
+	t.Run("Should return error if working_dir is relative", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    working_dir: src`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: working_dir must be an absolute path: src",
+			err.Error())
+	})
+
+	t.Run("Should return error if volume target is relative", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    volumes:
+      - source: ./testdata
+        target: testdata`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid volume at 0: target must be an absolute path: testdata",
+			err.Error())
+	})
+
+	t.Run("Should return error if cache name is invalid", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    caches:
+      - name: go build
+        path: /root/.cache/go-build`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid cache at 0: invalid name: go build",
+			err.Error())
+	})
+
+	t.Run("Should return error if memory limit is invalid", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    resources:
+      memory: lots`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid resources: invalid memory limit: lots: invalid size: 'lots'",
+			err.Error())
+	})
+
+	t.Run("Should return error if extra host is invalid", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    extra_hosts:
+      - db`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid extra host, expected host:ip: db",
+			err.Error())
+	})
+
+	t.Run("Should return error if network mode is invalid", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    network_mode: 'host; rm -rf /'`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid network_mode: host; rm -rf /",
+			err.Error())
+	})
+
+	t.Run("Should return error if capability is invalid", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: 'docker.io/library/golang:1.14'
+    cap_add:
+      - NET_ADMIN
+      - sys admin`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: invalid capability in cap_add: sys admin",
+			err.Error())
+	})
+
+	t.Run("Should return error if image is missing for a task with podman executor", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: podman
+    script:
+      - go build`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: image is required for podman executor",
+			err.Error())
+	})
+
+	t.Run("Should return error if sandbox is used with another executor", func(t *testing.T) {
+		c, err := cogsfile.Load([]byte((`
+tasks:
+  - name: build
+    executor: docker
+    image: alpine
+    sandbox:
+      enabled: true`)))
+
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Equal(t,
+			"validation failed: validation failed for task: build at 0: sandbox is only supported by the shell executor, got docker",
+			err.Error())
+	})
+}
+
+func TestMatchesPlatform(t *testing.T) {
+	t.Run("Should match the os and architecture of the platform", func(t *testing.T) {
+		assert.True(t, matchesPlatform("linux", "amd64", "linux/amd64"))
+		assert.True(t, matchesPlatform("linux", "arm", "linux/arm/v7"))
+	})
+
+	t.Run("Should only match the os of a platform without an architecture", func(t *testing.T) {
+		assert.True(t, matchesPlatform("linux", "amd64", "linux"))
+		assert.False(t, matchesPlatform("windows", "amd64", "linux"))
+	})
+
+	t.Run("Should not match another platform", func(t *testing.T) {
+		assert.False(t, matchesPlatform("linux", "amd64", "linux/arm64"))
+		assert.False(t, matchesPlatform("windows", "amd64", "linux/amd64"))
+	})
+}
@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// dockerTtySession runs a script inside a container TTY. Input written to a
+// TTY is echoed back, so the script is buffered and handed to the shell with
+// -c once CloseWrite is called instead of being streamed through stdin.
+type dockerTtySession struct {
+	ctx        context.Context
+	executor   *DockerExecutor
+	script     bytes.Buffer
+	output     *io.PipeReader
+	pipe       *io.PipeWriter
+	execID     string
+	stopResize func()
+	stop       func()
+}
+
+func newDockerTtySession(ctx context.Context, executor *DockerExecutor) *dockerTtySession {
+	reader, writer := io.Pipe()
+
+	return &dockerTtySession{
+		ctx:        ctx,
+		executor:   executor,
+		output:     reader,
+		pipe:       writer,
+		stopResize: func() {},
+		stop:       func() {},
+	}
+}
+
+func (s *dockerTtySession) Reader() io.Reader {
+	return s.output
+}
+
+func (s *dockerTtySession) Writer() io.Writer {
+	return &s.script
+}
+
+func (s *dockerTtySession) CloseWrite() error {
+	cmd := append(makeCommand(s.executor.shell, s.executor.shellArgs), "-c", s.script.String())
+
+	execID, response, err := s.executor.exec(s.ctx, cmd, true)
+
+	if err != nil {
+		s.pipe.CloseWithError(err)
+		return errors.Wrap(err, "error starting script")
+	}
+
+	s.execID = execID
+	s.stopResize = watchTerminalSize(s.executor.resizeExec(s.ctx, execID))
+	s.stop = s.executor.interruptOnDone(s.ctx, response)
+
+	go func() {
+		_, err := io.Copy(s.pipe, response.Reader)
+		response.Close()
+		s.pipe.CloseWithError(err)
+	}()
+
+	return nil
+}
+
+func (s *dockerTtySession) End(ctx context.Context) (int, error) {
+	s.stopResize()
+
+	s.stop()
+
+	if s.execID == "" {
+		return -1, errors.New("session was not started")
+	}
+
+	if s.ctx.Err() != nil {
+		return -1, errors.Wrap(s.ctx.Err(), "error while waiting for commands to end")
+	}
+
+	result, err := s.executor.client.ContainerExecInspect(ctx, s.execID)
+
+	if err != nil {
+		return -1, errors.Wrap(err, "error inspecting command execution")
+	}
+
+	return result.ExitCode, nil
+}
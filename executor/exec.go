@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const commandNotFoundExitCode = 127
+
+func init() {
+	Register(Exec, func(c Config) (Executor, error) {
+		e := NewExecExecutor(c.WorkingDirectory)
+		e.Env = c.environment(filepath.Join(c.WorkingDirectory, c.OutputFile))
+
+		return e, nil
+	}, noSandbox(validateCommands))
+}
+
+// validateCommands checks that every command line of a task can be split into
+// words.
+func validateCommands(task cogsfile.Task) error {
+	for _, script := range []cogsfile.Script{task.BeforeScript, task.Script, task.AfterScript} {
+		for _, command := range script {
+			_, err := command.Words()
+
+			if err != nil {
+				return errors.Wrapf(err, "invalid command %s", command.Line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExecExecutor runs each script command directly as a process instead of
+// piping the script into a shell. No expansion happens, execution stops at the
+// first failing command.
+type ExecExecutor struct {
+	WorkingDirectory string
+	Env              []string
+}
+
+func NewExecExecutor(workingDirectory string) *ExecExecutor {
+	return &ExecExecutor{WorkingDirectory: workingDirectory}
+}
+
+func (e *ExecExecutor) Name() string {
+	return "exec"
+}
+
+// Session is not supported, commands are run with RunCommands.
+func (e *ExecExecutor) Session(_ context.Context) (Session, error) {
+	return nil, errors.New("exec executor does not support sessions")
+}
+
+func (e *ExecExecutor) RunCommands(ctx context.Context, commands [][]string, output io.Writer) (int, error) {
+	for _, argv := range commands {
+		if len(argv) == 0 {
+			continue
+		}
+
+		exitCode, err := e.runCommand(ctx, argv, output)
+
+		if err != nil || exitCode != 0 {
+			return exitCode, err
+		}
+	}
+
+	return 0, nil
+}
+
+func (e *ExecExecutor) runCommand(ctx context.Context, argv []string, output io.Writer) (int, error) {
+	_, err := fmt.Fprintf(output, "+ %s\n", utils.ShellJoin(argv))
+
+	if err != nil {
+		return -1, errors.Wrap(err, "error writing output")
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = e.WorkingDirectory
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if len(e.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.Env...)
+	}
+
+	started := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(started).Round(time.Millisecond)
+
+	if ctx.Err() != nil {
+		return -1, errors.Wrap(ctx.Err(), "error while waiting for commands to end")
+	}
+
+	exitCode := 0
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		fmt.Fprintf(output, "%s: %s\n", argv[0], err)
+		exitCode = commandNotFoundExitCode
+	}
+
+	log.Printf("Command %s exited with code %d in %s\n", argv[0], exitCode, elapsed)
+
+	return exitCode, nil
+}
+
+func (e *ExecExecutor) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runTestScript(t *testing.T, e Executor, script string) (string, int) {
+	session, err := e.Session(context.Background())
+	require.Nil(t, err)
+
+	output := make(chan []byte)
+
+	go func() {
+		bytes, _ := ioutil.ReadAll(session.Reader())
+		output <- bytes
+	}()
+
+	_, err = io.WriteString(session.Writer(), script)
+	require.Nil(t, err)
+	require.Nil(t, session.CloseWrite())
+
+	result := <-output
+
+	exitCode, err := session.End(context.Background())
+	require.Nil(t, err)
+
+	return string(result), exitCode
+}
+
+func runTestCommands(t *testing.T, e Executor, commands ...[]string) (string, int) {
+	var output bytes.Buffer
+
+	exitCode, err := e.(CommandRunner).RunCommands(context.Background(), commands, &output)
+	require.Nil(t, err)
+
+	return output.String(), exitCode
+}
+
+func TestExecExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-exec")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := NewExecExecutor(dir)
+
+	t.Run("Should run commands without a shell", func(t *testing.T) {
+		output, exitCode := runTestCommands(t, e, []string{"echo", "a  b", "$HOME"}, []string{"pwd"})
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "+ echo 'a  b' '$HOME'\na  b $HOME\n+ pwd\n"+dir+"\n", output)
+	})
+
+	t.Run("Should pass arguments as they are", func(t *testing.T) {
+		long := strings.Repeat("x", 100000)
+
+		output, exitCode := runTestCommands(t, e, []string{"printf", "%s|%d", "a\nb", "1"}, []string{"sh", "-c", `echo ${#1}`, "sh", long})
+
+		assert.Equal(t, 0, exitCode)
+		assert.Contains(t, output, "a\nb|1")
+		assert.True(t, strings.HasSuffix(output, "\n100000\n"))
+	})
+
+	t.Run("Should stop at the first failing command", func(t *testing.T) {
+		output, exitCode := runTestCommands(t, e, []string{"sh", "-c", "exit 4"}, []string{"echo", "unreachable"})
+
+		assert.Equal(t, 4, exitCode)
+		assert.Equal(t, "+ sh -c 'exit 4'\n", output)
+	})
+
+	t.Run("Should fail when the command does not exist", func(t *testing.T) {
+		_, exitCode := runTestCommands(t, e, []string{"cogs-nonexistent-command"})
+
+		assert.Equal(t, commandNotFoundExitCode, exitCode)
+	})
+
+	t.Run("Should pass task environment", func(t *testing.T) {
+		e, err := New("exec", Config{WorkingDirectory: dir, Env: map[string]string{"TAG": "v1"}, OutputFile: "out"})
+		require.Nil(t, err)
+
+		output, exitCode := runTestCommands(t, e, []string{"sh", "-c", "echo $TAG $COGS_OUTPUT"})
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "+ sh -c 'echo $TAG $COGS_OUTPUT'\nv1 "+filepath.Join(dir, "out")+"\n", output)
+	})
+}
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"github.com/kinematic-ci/cogs/events"
 	"io"
 )
 
@@ -17,3 +18,28 @@ type Executor interface {
 	Session(ctx context.Context) (Session, error)
 	Close(ctx context.Context) error
 }
+
+// Interactive is implemented by executors which can attach the terminal of
+// the current process to a shell inside the task environment.
+type Interactive interface {
+	Interactive(ctx context.Context) error
+}
+
+// CommandRunner is implemented by executors which run every command of a
+// script as a process of its own, given as an argv list, instead of passing
+// the script to a session.
+type CommandRunner interface {
+	RunCommands(ctx context.Context, commands [][]string, output io.Writer) (int, error)
+}
+
+// publishStep publishes the start and the end of a step an executor takes to
+// prepare the environment of a task.
+func publishStep(bus *events.Bus, task, executor, step string, run func() error) error {
+	bus.Publish(events.Event{Type: events.ExecutorStepStarted, Task: task, Executor: executor, Step: step})
+
+	err := run()
+
+	bus.Publish(events.Event{Type: events.ExecutorStepFinished, Task: task, Executor: executor, Step: step}.WithError(err))
+
+	return err
+}
@@ -0,0 +1,416 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PluginBinaryPrefix is prepended to a plugin name to find its binary on PATH.
+const PluginBinaryPrefix = "cogs-executor-"
+
+// pluginMessage is a single line of the plugin protocol. Requests sent by cogs
+// carry an id and a method, responses echo the id with a result or an error.
+// Plugins report output with "output" events and the end of a session's
+// output with an "eof" event. A session is stopped with a "cancel" message,
+// the plugin is killed when it doesn't end in time. See the README for the
+// full protocol.
+type pluginMessage struct {
+	ID      int             `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Session string          `json:"session,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Event   string          `json:"event,omitempty"`
+}
+
+type pluginConfig struct {
+	Task             string   `json:"task"`
+	Image            string   `json:"image,omitempty"`
+	WorkingDirectory string   `json:"working_directory"`
+	Shell            string   `json:"shell"`
+	ShellArgs        []string `json:"shell_args"`
+	Tty              bool     `json:"tty"`
+	Env              []string `json:"env"`
+}
+
+type pluginEndResult struct {
+	ExitCode int `json:"exit_code"`
+}
+
+type pluginSession struct {
+	ctx      context.Context
+	executor *PluginExecutor
+	id       string
+	output   *io.PipeReader
+	done     chan struct{}
+}
+
+// newPluginSession cancels the session once ctx is done and kills the plugin
+// if the session doesn't end in time.
+func newPluginSession(ctx context.Context, executor *PluginExecutor, id string, output *io.PipeReader) *pluginSession {
+	s := &pluginSession{ctx: ctx, executor: executor, id: id, output: output, done: make(chan struct{})}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+			return
+		}
+
+		err := executor.send(pluginMessage{Method: "cancel", Session: id})
+
+		if err == nil {
+			select {
+			case <-s.done:
+				return
+			case <-time.After(executor.killTimeout):
+			}
+		}
+
+		executor.kill()
+	}()
+
+	return s
+}
+
+func (s *pluginSession) Reader() io.Reader {
+	return s.output
+}
+
+func (s *pluginSession) Writer() io.Writer {
+	return s
+}
+
+func (s *pluginSession) Write(p []byte) (int, error) {
+	err := s.executor.send(pluginMessage{Method: "write", Session: s.id, Data: p})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *pluginSession) CloseWrite() error {
+	err := s.executor.call(s.ctx, pluginMessage{Method: "close_write", Session: s.id}, nil)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to close IO")
+	}
+
+	return nil
+}
+
+// End waits for the plugin even when the session was cancelled, which either
+// ends the session or gets the plugin killed.
+func (s *pluginSession) End(_ context.Context) (int, error) {
+	var result pluginEndResult
+
+	err := s.executor.call(context.Background(), pluginMessage{Method: "end", Session: s.id}, &result)
+	close(s.done)
+
+	if s.ctx.Err() != nil {
+		return -1, errors.Wrap(s.ctx.Err(), "error ending session")
+	}
+
+	if err != nil {
+		return -1, errors.Wrap(err, "error ending session")
+	}
+
+	return result.ExitCode, nil
+}
+
+// PluginExecutor delegates to an external cogs-executor-<name> binary which
+// speaks newline delimited JSON over its stdin and stdout.
+type PluginExecutor struct {
+	name        string
+	config      Config
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	sendLock    sync.Mutex
+	lock        sync.Mutex
+	nextID      int
+	nextSession int
+	pending     map[int]chan pluginMessage
+	sessions    map[string]*io.PipeWriter
+	err         error
+	killTimeout time.Duration
+}
+
+func NewPluginExecutor(name string, config Config) *PluginExecutor {
+	return &PluginExecutor{
+		name:        name,
+		config:      config,
+		pending:     map[int]chan pluginMessage{},
+		sessions:    map[string]*io.PipeWriter{},
+		killTimeout: killTimeout,
+	}
+}
+
+func (e *PluginExecutor) Name() string {
+	return PluginPrefix + e.name
+}
+
+func (e *PluginExecutor) start(ctx context.Context) error {
+	binary, err := exec.LookPath(PluginBinaryPrefix + e.name)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to find plugin %s", e.name)
+	}
+
+	cmd := exec.Command(binary)
+	cmd.Dir = e.config.WorkingDirectory
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to pipe STDIN")
+	}
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to pipe STDOUT")
+	}
+
+	err = cmd.Start()
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to start plugin %s", e.name)
+	}
+
+	e.cmd = cmd
+	e.stdin = stdin
+
+	go e.receive(stdout)
+
+	return e.call(ctx, pluginMessage{Method: "init", Params: pluginConfig{
+		Task:             e.config.Task,
+		Image:            e.config.Image,
+		WorkingDirectory: e.config.WorkingDirectory,
+		Shell:            e.config.Shell,
+		ShellArgs:        e.config.ShellArgs,
+		Tty:              e.config.Tty,
+		Env:              e.config.environment(filepath.Join(e.config.WorkingDirectory, e.config.OutputFile)),
+	}}, nil)
+}
+
+func (e *PluginExecutor) receive(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var message pluginMessage
+
+		err := json.Unmarshal(scanner.Bytes(), &message)
+
+		if err != nil {
+			e.fail(errors.Wrap(err, "invalid message from plugin"))
+			return
+		}
+
+		e.dispatch(message)
+	}
+
+	err := scanner.Err()
+
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+
+	e.fail(errors.Wrap(err, "plugin stopped responding"))
+}
+
+func (e *PluginExecutor) dispatch(message pluginMessage) {
+	e.lock.Lock()
+
+	if message.Event != "" {
+		output := e.sessions[message.Session]
+
+		if message.Event == "eof" {
+			delete(e.sessions, message.Session)
+		}
+
+		e.lock.Unlock()
+
+		if output == nil {
+			return
+		}
+
+		switch message.Event {
+		case "output":
+			_, _ = output.Write(message.Data)
+		case "eof":
+			output.Close()
+		}
+
+		return
+	}
+
+	response, found := e.pending[message.ID]
+	delete(e.pending, message.ID)
+	e.lock.Unlock()
+
+	if found {
+		response <- message
+	}
+}
+
+func (e *PluginExecutor) fail(err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.err = err
+
+	for id, response := range e.pending {
+		response <- pluginMessage{ID: id, Error: err.Error()}
+		delete(e.pending, id)
+	}
+
+	for id, output := range e.sessions {
+		output.CloseWithError(err)
+		delete(e.sessions, id)
+	}
+}
+
+func (e *PluginExecutor) send(message pluginMessage) error {
+	bytes, err := json.Marshal(message)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to encode message")
+	}
+
+	e.sendLock.Lock()
+	defer e.sendLock.Unlock()
+
+	_, err = e.stdin.Write(append(bytes, '\n'))
+
+	if err != nil {
+		return errors.Wrap(err, "unable to send message to plugin")
+	}
+
+	return nil
+}
+
+func (e *PluginExecutor) call(ctx context.Context, message pluginMessage, result interface{}) error {
+	response := make(chan pluginMessage, 1)
+
+	e.lock.Lock()
+
+	if e.err != nil {
+		e.lock.Unlock()
+		return e.err
+	}
+
+	e.nextID++
+	message.ID = e.nextID
+	e.pending[message.ID] = response
+	e.lock.Unlock()
+
+	err := e.send(message)
+
+	if err != nil {
+		return err
+	}
+
+	var reply pluginMessage
+
+	select {
+	case reply = <-response:
+	case <-ctx.Done():
+		e.lock.Lock()
+		delete(e.pending, message.ID)
+		e.lock.Unlock()
+
+		return errors.Wrapf(ctx.Err(), "plugin %s: %s failed", e.name, message.Method)
+	}
+
+	if reply.Error != "" {
+		return errors.Errorf("plugin %s: %s failed: %s", e.name, message.Method, reply.Error)
+	}
+
+	if result != nil && len(reply.Result) > 0 {
+		err = json.Unmarshal(reply.Result, result)
+
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s result from plugin", message.Method)
+		}
+	}
+
+	return nil
+}
+
+// kill stops a plugin which doesn't respond, which fails all pending calls
+// once its output is closed.
+func (e *PluginExecutor) kill() {
+	_ = e.cmd.Process.Kill()
+}
+
+func (e *PluginExecutor) Session(ctx context.Context) (Session, error) {
+	if e.cmd == nil {
+		err := e.start(ctx)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating session")
+		}
+	}
+
+	reader, writer := io.Pipe()
+
+	e.lock.Lock()
+	e.nextSession++
+	id := strconv.Itoa(e.nextSession)
+	e.sessions[id] = writer
+	e.lock.Unlock()
+
+	err := e.call(ctx, pluginMessage{Method: "session", Session: id}, nil)
+
+	if err != nil {
+		e.lock.Lock()
+		delete(e.sessions, id)
+		e.lock.Unlock()
+
+		return nil, errors.Wrap(err, "error creating session")
+	}
+
+	return newPluginSession(ctx, e, id, reader), nil
+}
+
+// Close asks the plugin to exit and kills it if it doesn't in time.
+func (e *PluginExecutor) Close(ctx context.Context) error {
+	if e.cmd == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.killTimeout)
+	defer cancel()
+
+	err := e.call(ctx, pluginMessage{Method: "close"}, nil)
+
+	e.stdin.Close()
+
+	timer := time.AfterFunc(e.killTimeout, e.kill)
+	defer timer.Stop()
+
+	if waitErr := e.cmd.Wait(); err == nil && waitErr != nil {
+		err = waitErr
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error closing plugin %s", e.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	pluginHelperEnv       = "COGS_TEST_PLUGIN_HELPER"
+	pluginIgnoreCancelEnv = "COGS_TEST_PLUGIN_IGNORE_CANCEL"
+)
+
+// TestPluginHelperProcess is not a real test. It is started by the plugin
+// wrapper script and implements the plugin protocol on top of /bin/sh.
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv(pluginHelperEnv) != "1" {
+		return
+	}
+
+	var sendLock sync.Mutex
+	encoder := json.NewEncoder(os.Stdout)
+
+	send := func(message pluginMessage) {
+		sendLock.Lock()
+		defer sendLock.Unlock()
+		_ = encoder.Encode(message)
+	}
+
+	var config pluginConfig
+	sessions := map[string]*exec.Cmd{}
+	stdins := map[string]io.WriteCloser{}
+	done := map[string]chan struct{}{}
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		var message pluginMessage
+		message.Params = &config
+
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		switch message.Method {
+		case "init":
+			send(pluginMessage{ID: message.ID})
+		case "session":
+			cmd := exec.Command(config.Shell, config.ShellArgs...)
+			cmd.Dir = config.WorkingDirectory
+			stdin, _ := cmd.StdinPipe()
+			stdout, _ := cmd.StdoutPipe()
+			cmd.Stderr = cmd.Stdout
+
+			if err := cmd.Start(); err != nil {
+				send(pluginMessage{ID: message.ID, Error: err.Error()})
+				continue
+			}
+
+			id := message.Session
+			sessions[id] = cmd
+			stdins[id] = stdin
+			done[id] = make(chan struct{})
+
+			go func() {
+				buffer := make([]byte, 1024)
+
+				for {
+					n, err := stdout.Read(buffer)
+
+					if n > 0 {
+						send(pluginMessage{Event: "output", Session: id, Data: append([]byte{}, buffer[:n]...)})
+					}
+
+					if err != nil {
+						break
+					}
+				}
+
+				send(pluginMessage{Event: "eof", Session: id})
+				close(done[id])
+			}()
+
+			send(pluginMessage{ID: message.ID})
+		case "write":
+			_, _ = stdins[message.Session].Write(message.Data)
+		case "close_write":
+			_ = stdins[message.Session].Close()
+			send(pluginMessage{ID: message.ID})
+		case "cancel":
+			if os.Getenv(pluginIgnoreCancelEnv) != "1" {
+				_ = sessions[message.Session].Process.Kill()
+			}
+		case "end":
+			go func(id int, cmd *exec.Cmd, done chan struct{}) {
+				<-done
+				_ = cmd.Wait()
+				result, _ := json.Marshal(pluginEndResult{ExitCode: cmd.ProcessState.ExitCode()})
+				send(pluginMessage{ID: id, Result: result})
+			}(message.ID, sessions[message.Session], done[message.Session])
+		case "close":
+			send(pluginMessage{ID: message.ID})
+			os.Exit(0)
+		default:
+			send(pluginMessage{ID: message.ID, Error: "unknown method " + message.Method})
+		}
+	}
+
+	os.Exit(0)
+}
+
+func installTestPlugin(t *testing.T, dir, name string, env ...string) {
+	env = append(env, pluginHelperEnv+"=1")
+	script := fmt.Sprintf("#!/bin/sh\n%s exec %s -test.run=TestPluginHelperProcess\n", strings.Join(env, " "), os.Args[0])
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, PluginBinaryPrefix+name), []byte(script), 0755))
+}
+
+func TestPluginExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-plugin")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	installTestPlugin(t, dir, "fake")
+	installTestPlugin(t, dir, "stubborn", pluginIgnoreCancelEnv+"=1")
+
+	path := os.Getenv("PATH")
+	require.Nil(t, os.Setenv("PATH", dir+string(os.PathListSeparator)+path))
+	defer os.Setenv("PATH", path)
+
+	config := Config{Task: "build", WorkingDirectory: dir, Shell: "/bin/sh", ShellArgs: []string{"-e"}}
+
+	t.Run("Should be created through the registry", func(t *testing.T) {
+		assert.True(t, Registered("plugin:fake"))
+
+		e, err := New("plugin:fake", config)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "plugin:fake", e.Name())
+	})
+
+	t.Run("Should run sessions through the plugin", func(t *testing.T) {
+		e := NewPluginExecutor("fake", config)
+
+		output, exitCode := runTestScript(t, e, "echo hello\npwd\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "hello\n"+dir+"\n", output)
+
+		output, exitCode = runTestScript(t, e, "echo failing\nexit 5\n")
+
+		assert.Equal(t, 5, exitCode)
+		assert.Equal(t, "failing\n", output)
+
+		assert.Nil(t, e.Close(context.Background()))
+	})
+
+	t.Run("Should cancel the session when the context is done", func(t *testing.T) {
+		e := NewPluginExecutor("fake", config)
+
+		exitCode, err := runCancelledPluginSession(t, e)
+
+		assert.Equal(t, -1, exitCode)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+
+		assert.Nil(t, e.Close(context.Background()))
+	})
+
+	t.Run("Should kill a plugin which does not end a cancelled session", func(t *testing.T) {
+		e := NewPluginExecutor("stubborn", config)
+		e.killTimeout = 100 * time.Millisecond
+
+		start := time.Now()
+		exitCode, err := runCancelledPluginSession(t, e)
+
+		assert.Equal(t, -1, exitCode)
+		assert.NotNil(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+		_, err = e.Session(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Empty(t, e.sessions)
+		assert.NotNil(t, e.Close(context.Background()))
+	})
+
+	t.Run("Should return error if plugin is missing", func(t *testing.T) {
+		e := NewPluginExecutor("missing", config)
+
+		_, err := e.Session(context.Background())
+
+		assert.NotNil(t, err)
+	})
+}
+
+// runCancelledPluginSession runs a script which outlives the timeout of its
+// session.
+func runCancelledPluginSession(t *testing.T, e *PluginExecutor) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	session, err := e.Session(ctx)
+	require.Nil(t, err)
+
+	_, err = session.Writer().Write([]byte("exec sleep 5\n"))
+	require.Nil(t, err)
+	require.Nil(t, session.CloseWrite())
+
+	_, _ = ioutil.ReadAll(session.Reader())
+
+	return session.End(context.Background())
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("Should know built-in executors", func(t *testing.T) {
+		assert.Equal(t, []string{"docker", "exec", "podman", "shell", "ssh"}, Names())
+		assert.True(t, Registered("shell"))
+	})
+
+	t.Run("Should reject unknown executors", func(t *testing.T) {
+		assert.False(t, Registered("blah"))
+		assert.False(t, Registered("plugin:"))
+
+		_, err := New("blah", Config{})
+
+		assert.EqualError(t, err, "unknown executor: blah")
+	})
+
+	t.Run("Should validate tasks with their executor", func(t *testing.T) {
+		sshTask := cogsfile.Task{Name: "build", Executor: SSH, SSH: cogsfile.SSHConfig{User: "ci", Key: "~/.ssh/id_ed25519"}}
+		execTask := cogsfile.Task{Name: "build", Executor: Exec, Script: cogsfile.Script{{Line: "echo 'unterminated"}}}
+
+		assert.EqualError(t, cogsfile.ValidateExecutor(sshTask), "invalid ssh configuration: host is required")
+		assert.EqualError(t, cogsfile.ValidateExecutor(execTask), "invalid command echo 'unterminated: unterminated single quote")
+		assert.EqualError(t, cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: "blah"}), "unsupported executor: blah")
+		assert.EqualError(t, cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: "plugin:"}), "unsupported executor: plugin:")
+		assert.Nil(t, cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: "plugin:fake"}))
+		assert.Nil(t, cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: Shell}))
+	})
+
+	t.Run("Should only accept the sandbox for the shell executor", func(t *testing.T) {
+		sandbox := cogsfile.Sandbox{Enabled: true}
+
+		assert.Nil(t, cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: Shell, Sandbox: sandbox}))
+		assert.EqualError(t,
+			cogsfile.ValidateExecutor(cogsfile.Task{Name: "build", Executor: "plugin:fake", Sandbox: sandbox}),
+			"sandbox is only supported by the shell executor, got plugin:fake")
+	})
+}
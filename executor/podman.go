@@ -0,0 +1,78 @@
+package executor
+
+import (
+	docker "github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	podmanHostEnv      = "CONTAINER_HOST"
+	podmanRootlessPath = "podman/podman.sock"
+	podmanRootfulHost  = "unix:///run/podman/podman.sock"
+)
+
+func init() {
+	Register(Podman, func(c Config) (Executor, error) {
+		client, err := NewPodmanClient()
+
+		if err != nil {
+			return nil, err
+		}
+
+		e := NewPodmanExecutor(c.Task, c.Image, c.WorkingDirectory, c.Shell, c.ShellArgs, c.Container, client)
+		e.ownsClient = true
+		e.useEnvironment(c)
+		e.events = c.Events
+
+		return e, nil
+	}, noSandbox(validateContainer))
+}
+
+// NewPodmanClient connects to the Docker compatible REST API served by
+// `podman system service`. The socket is taken from CONTAINER_HOST when set,
+// otherwise the rootless socket in XDG_RUNTIME_DIR or the rootful one is used.
+func NewPodmanClient() (*docker.Client, error) {
+	client, err := docker.NewClientWithOpts(docker.WithHost(podmanHost(os.Getenv, os.Getuid())), docker.WithAPIVersionNegotiation())
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create podman client")
+	}
+
+	return client, nil
+}
+
+func podmanHost(getenv func(string) string, uid int) string {
+	if host := getenv(podmanHostEnv); host != "" {
+		return host
+	}
+
+	if runtimeDir := getenv("XDG_RUNTIME_DIR"); runtimeDir != "" && uid != 0 {
+		return "unix://" + filepath.Join(runtimeDir, podmanRootlessPath)
+	}
+
+	return podmanRootfulHost
+}
+
+// NewPodmanExecutor creates an executor running tasks through Podman. Podman
+// serves the Docker API, so containers are managed exactly like DockerExecutor
+// does, apart from the user the scripts run as.
+func NewPodmanExecutor(name, image, workingDirectory, shell string, args []string, options ContainerOptions, client *docker.Client) *DockerExecutor {
+	e := NewDockerExecutor(name, image, workingDirectory, shell, args, options, client)
+	e.name = "podman"
+	e.user = podmanUserId(os.Getuid())
+
+	return e
+}
+
+// podmanUserId returns the user scripts run as so that files written to the
+// working directory end up owned by the current user. Rootless Podman maps
+// root inside the container onto the user running it.
+func podmanUserId(uid int) string {
+	if uid > 0 {
+		return fallbackUserId
+	}
+
+	return userId()
+}
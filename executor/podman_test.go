@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPodmanHost(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		uid  int
+		host string
+	}{
+		{
+			name: "Should use CONTAINER_HOST when set",
+			env:  map[string]string{"CONTAINER_HOST": "tcp://podman:8080", "XDG_RUNTIME_DIR": "/run/user/1000"},
+			uid:  1000,
+			host: "tcp://podman:8080",
+		},
+		{
+			name: "Should use the rootless socket in XDG_RUNTIME_DIR",
+			env:  map[string]string{"XDG_RUNTIME_DIR": "/run/user/1000"},
+			uid:  1000,
+			host: "unix:///run/user/1000/podman/podman.sock",
+		},
+		{
+			name: "Should use the rootful socket for root",
+			env:  map[string]string{"XDG_RUNTIME_DIR": "/run/user/0"},
+			uid:  0,
+			host: podmanRootfulHost,
+		},
+		{
+			name: "Should use the rootful socket without XDG_RUNTIME_DIR",
+			env:  map[string]string{},
+			uid:  1000,
+			host: podmanRootfulHost,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			getenv := func(name string) string {
+				return test.env[name]
+			}
+
+			assert.Equal(t, test.host, podmanHost(getenv, test.uid))
+		})
+	}
+}
+
+func TestPodmanUserId(t *testing.T) {
+	t.Run("Should run as root inside the container for rootless podman", func(t *testing.T) {
+		assert.Equal(t, "0", podmanUserId(1000))
+	})
+
+	t.Run("Should run as the current user for rootful podman", func(t *testing.T) {
+		assert.Equal(t, userId(), podmanUserId(0))
+	})
+}
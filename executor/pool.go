@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/docker/docker/api/types/container"
+	docker "github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContainerPool keeps containers started by DockerExecutor running for the
+// duration of a run, so that tasks using the same image and mount
+// configuration can reuse a warm container instead of starting a new one.
+type ContainerPool struct {
+	client *docker.Client
+	mutex  sync.Mutex
+	idle   map[string][]string
+	all    []string
+}
+
+func NewContainerPool(client *docker.Client) *ContainerPool {
+	return &ContainerPool{
+		client: client,
+		idle:   map[string][]string{},
+	}
+}
+
+func (p *ContainerPool) acquire(key string) (string, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	containers := p.idle[key]
+
+	if len(containers) == 0 {
+		return "", false
+	}
+
+	containerID := containers[len(containers)-1]
+	p.idle[key] = containers[:len(containers)-1]
+
+	return containerID, true
+}
+
+func (p *ContainerPool) track(containerID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.all = append(p.all, containerID)
+}
+
+func (p *ContainerPool) release(key, containerID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.idle[key] = append(p.idle[key], containerID)
+}
+
+// Close stops every container started through the pool. Containers which
+// could not be stopped are kept, so that closing again retries them.
+func (p *ContainerPool) Close(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	log.Printf("Stopping %d pooled containers\n", len(p.all))
+
+	timeout := 1 * time.Second
+	var failed []string
+
+	for _, containerID := range p.all {
+		err := p.client.ContainerStop(ctx, containerID, &timeout)
+
+		if err != nil {
+			log.Printf("Error stopping pooled container %s: %s\n", containerID, err)
+			failed = append(failed, containerID)
+		}
+	}
+
+	p.all = failed
+	p.idle = map[string][]string{}
+
+	if len(failed) > 0 {
+		return errors.Errorf("unable to stop pooled containers: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func poolKey(config *container.Config, hostConfig *container.HostConfig, platform string) (string, error) {
+	bytes, err := json.Marshal(struct {
+		Config     *container.Config
+		HostConfig *container.HostConfig
+		Platform   string
+	}{config, hostConfig, platform})
+
+	if err != nil {
+		return "", errors.Wrap(err, "unable to serialize container configuration")
+	}
+
+	hash := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"context"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	docker "github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContainerPool(t *testing.T) {
+	t.Run("Should not return a container for an unknown key", func(t *testing.T) {
+		pool := NewContainerPool(nil)
+
+		containerID, found := pool.acquire("golang")
+
+		assert.False(t, found)
+		assert.Equal(t, "", containerID)
+	})
+
+	t.Run("Should return released containers once", func(t *testing.T) {
+		pool := NewContainerPool(nil)
+
+		pool.track("abc")
+		pool.release("golang", "abc")
+
+		containerID, found := pool.acquire("golang")
+
+		assert.True(t, found)
+		assert.Equal(t, "abc", containerID)
+
+		_, found = pool.acquire("golang")
+
+		assert.False(t, found)
+	})
+
+	t.Run("Should stop the remaining containers when one fails to stop", func(t *testing.T) {
+		var mutex sync.Mutex
+		var stopped []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if strings.Contains(r.URL.Path, "/containers/broken/") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			stopped = append(stopped, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		client, err := docker.NewClientWithOpts(docker.WithHost("tcp://"+server.Listener.Addr().String()), docker.WithVersion("1.40"))
+		require.Nil(t, err)
+
+		pool := NewContainerPool(client)
+		pool.track("first")
+		pool.track("broken")
+		pool.track("last")
+
+		err = pool.Close(context.Background())
+
+		assert.EqualError(t, err, "unable to stop pooled containers: broken")
+		assert.Equal(t, []string{"/v1.40/containers/first/stop", "/v1.40/containers/last/stop"}, stopped)
+	})
+
+	t.Run("Should not share containers between keys", func(t *testing.T) {
+		pool := NewContainerPool(nil)
+
+		pool.release("golang", "abc")
+
+		_, found := pool.acquire("python")
+
+		assert.False(t, found)
+	})
+}
+
+func TestPoolKey(t *testing.T) {
+	config := &container.Config{Image: "golang:1.14", WorkingDir: "/ci"}
+
+	hostConfig := func(readOnly bool) *container.HostConfig {
+		return &container.HostConfig{
+			Mounts: []mount.Mount{{Type: mount.TypeBind, Source: "/src", Target: "/ci", ReadOnly: readOnly}},
+		}
+	}
+
+	t.Run("Should be stable for identical configuration", func(t *testing.T) {
+		first, err := poolKey(config, hostConfig(false), "")
+		assert.Nil(t, err)
+
+		second, err := poolKey(config, hostConfig(false), "")
+		assert.Nil(t, err)
+
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("Should differ when mounts differ", func(t *testing.T) {
+		first, err := poolKey(config, hostConfig(false), "")
+		assert.Nil(t, err)
+
+		second, err := poolKey(config, hostConfig(true), "")
+		assert.Nil(t, err)
+
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("Should differ when platforms differ", func(t *testing.T) {
+		first, err := poolKey(config, hostConfig(false), "linux/amd64")
+		assert.Nil(t, err)
+
+		second, err := poolKey(config, hostConfig(false), "linux/arm64")
+		assert.Nil(t, err)
+
+		assert.NotEqual(t, first, second)
+	})
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kinematic-ci/cogs/utils"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup makes a command the leader of a new process group, so that
+// it can be killed together with everything it spawns. Commands started in a
+// new session already lead their own group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setpgid = !cmd.SysProcAttr.Setsid
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	if err == syscall.ESRCH {
+		return nil
+	}
+
+	return err
+}
+
+// processGroupMembers describes the processes still running in a process
+// group, ignoring zombies. It relies on /proc and finds nothing where that
+// isn't available.
+func processGroupMembers(cmd *exec.Cmd) []string {
+	pgid := strconv.Itoa(cmd.Process.Pid)
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+
+	var members []string
+
+	for _, stat := range stats {
+		content, err := ioutil.ReadFile(stat)
+
+		if err != nil {
+			continue
+		}
+
+		// The command name is in parentheses and may contain spaces, the
+		// state, parent pid and process group follow it.
+		end := bytes.LastIndexByte(content, ')')
+
+		if end < 0 {
+			continue
+		}
+
+		fields := strings.Fields(string(content[end+1:]))
+
+		if len(fields) < 3 || fields[0] == "Z" || fields[2] != pgid {
+			continue
+		}
+
+		pid := filepath.Base(filepath.Dir(stat))
+		name := string(content[bytes.IndexByte(content, '(')+1 : end])
+		members = append(members, fmt.Sprintf("%s %s", pid, commandLine(pid, name)))
+	}
+
+	return members
+}
+
+func commandLine(pid string, name string) string {
+	content, _ := ioutil.ReadFile(filepath.Join("/proc", pid, "cmdline"))
+	cmdline := strings.TrimSpace(strings.Replace(string(content), "\x00", " ", -1))
+
+	return utils.StringOrDefault(cmdline, name)
+}
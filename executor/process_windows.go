@@ -0,0 +1,17 @@
+package executor
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(_ *exec.Cmd) {}
+
+// killProcessGroup only kills the command itself, child processes are not
+// tracked on windows.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func processGroupMembers(_ *exec.Cmd) []string {
+	return nil
+}
@@ -0,0 +1,160 @@
+package executor
+
+import (
+	docker "github.com/docker/docker/client"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	Docker = "docker"
+	Shell  = "shell"
+	Podman = "podman"
+	SSH    = "ssh"
+	Exec   = "exec"
+
+	// PluginPrefix marks executors provided by a cogs-executor-<name> plugin.
+	PluginPrefix = "plugin:"
+
+	// OutputEnv names the variable holding the path of the file a task
+	// writes its key=value outputs to.
+	OutputEnv = "COGS_OUTPUT"
+)
+
+// Config holds everything an executor may need to run a task.
+type Config struct {
+	Task             string
+	Image            string
+	WorkingDirectory string
+	Shell            string
+	ShellArgs        []string
+	Tty              bool
+	Container        ContainerOptions
+	SSH              SSHConfig
+	Sandbox          *SandboxConfig
+	Env              map[string]string
+	OutputFile       string
+	Events           *events.Bus
+	Docker           *docker.Client
+	Pool             *ContainerPool
+}
+
+type Factory func(config Config) (Executor, error)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Factory{}
+)
+
+func init() {
+	cogsfile.RegisterExecutorPrefix(PluginPrefix, noSandbox(nil))
+}
+
+// Register makes an executor available under the given name and lets the
+// Cogsfile accept it, validate checks the settings only the executor uses and
+// may be nil. Built-in executors register themselves when the package is
+// initialised.
+func Register(name string, factory Factory, validate cogsfile.Validator) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic("executor already registered: " + name)
+	}
+
+	registry[name] = factory
+	cogsfile.RegisterExecutor(name, validate)
+}
+
+// noSandbox rejects tasks using the sandbox, which only the shell executor
+// supports, before running validate.
+func noSandbox(validate cogsfile.Validator) cogsfile.Validator {
+	return func(task cogsfile.Task) error {
+		if task.Sandbox.Enabled {
+			return errors.Errorf("sandbox is only supported by the shell executor, got %s", task.Executor)
+		}
+
+		if validate == nil {
+			return nil
+		}
+
+		return validate(task)
+	}
+}
+
+// Registered reports whether New can create an executor with the given name.
+func Registered(name string) bool {
+	if pluginName(name) != "" {
+		return true
+	}
+
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	_, found := registry[name]
+
+	return found
+}
+
+// Names returns the names of all registered executors.
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func New(name string, config Config) (Executor, error) {
+	if plugin := pluginName(name); plugin != "" {
+		return NewPluginExecutor(plugin, config), nil
+	}
+
+	registryMutex.RLock()
+	factory, found := registry[name]
+	registryMutex.RUnlock()
+
+	if !found {
+		return nil, errors.Errorf("unknown executor: %s", name)
+	}
+
+	return factory(config)
+}
+
+// environment returns the task variables as sorted KEY=value pairs, adding
+// COGS_OUTPUT when the task has an output file. outputFile is the path of
+// that file as seen by the task.
+func (c Config) environment(outputFile string) []string {
+	env := make([]string, 0, len(c.Env)+1)
+
+	for key, value := range c.Env {
+		env = append(env, key+"="+value)
+	}
+
+	sort.Strings(env)
+
+	if c.OutputFile != "" {
+		env = append(env, OutputEnv+"="+outputFile)
+	}
+
+	return env
+}
+
+func pluginName(name string) string {
+	if !strings.HasPrefix(name, PluginPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(name, PluginPrefix)
+}
@@ -0,0 +1,358 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sandboxInit        = "cogs-sandbox-init"
+	sandboxSpecEnv     = "COGS_SANDBOX_SPEC"
+	sandboxFailureCode = 125
+)
+
+type sandboxSpec struct {
+	WorkingDirectory string
+	WritablePaths    []string
+	Network          bool
+}
+
+func init() {
+	reexec.Register(sandboxInit, runSandboxInit)
+}
+
+// sandboxCommand wraps a shell so that it starts in new user, mount, pid and
+// network namespaces. The current user is mapped to root inside the sandbox,
+// which lets the init process rearrange mounts before handing over to the
+// shell. Files written to the host are still owned by the current user.
+func sandboxCommand(shell string, args []string, workingDirectory string, config SandboxConfig) (*exec.Cmd, error) {
+	spec, err := json.Marshal(sandboxSpec{
+		WorkingDirectory: workingDirectory,
+		WritablePaths:    config.WritablePaths,
+		Network:          config.Network,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to serialize sandbox configuration")
+	}
+
+	cmd := reexec.Command(append([]string{sandboxInit, shell}, args...)...)
+	cmd.Dir = workingDirectory
+	cmd.Env = append(os.Environ(), sandboxSpecEnv+"="+string(spec))
+
+	cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+
+	if !config.Network {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	return cmd, nil
+}
+
+// runSandboxInit runs inside the new namespaces, prepares the file system and
+// replaces itself with the shell.
+func runSandboxInit() {
+	var spec sandboxSpec
+
+	err := json.Unmarshal([]byte(os.Getenv(sandboxSpecEnv)), &spec)
+
+	if err == nil {
+		err = setupSandbox(spec)
+	}
+
+	if err == nil {
+		err = execShell(os.Args[1:])
+	}
+
+	// Sessions only capture STDOUT, so report failures there.
+	fmt.Fprintln(os.Stdout, "cogs sandbox:", err)
+	os.Exit(sandboxFailureCode)
+}
+
+func setupSandbox(spec sandboxSpec) error {
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to make mounts private")
+	}
+
+	writable := append([]string{spec.WorkingDirectory}, spec.WritablePaths...)
+
+	// Writable paths get their own mounts before the root becomes read-only.
+	// They are kept open so they can still be reached once a fresh /tmp hides
+	// the ones below it.
+	handles := make([]int, len(writable))
+
+	for i, path := range writable {
+		err = unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, "")
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to bind %s", path)
+		}
+
+		handles[i], err = unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to open %s", path)
+		}
+	}
+
+	err = remountAllReadOnly(writable)
+
+	if err != nil {
+		return err
+	}
+
+	if !isWithin("/tmp", writable) {
+		err = unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+
+		if err != nil {
+			return errors.Wrap(err, "unable to mount /tmp")
+		}
+	}
+
+	for i, path := range writable {
+		err = bindWritable(handles[i], path)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to keep %s writable", path)
+		}
+	}
+
+	err = unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to mount /proc")
+	}
+
+	if !spec.Network {
+		err = loopbackUp()
+
+		if err != nil {
+			return errors.Wrap(err, "unable to bring up loopback interface")
+		}
+	}
+
+	err = unix.Chdir(spec.WorkingDirectory)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to change directory to %s", spec.WorkingDirectory)
+	}
+
+	return nil
+}
+
+// bindWritable mounts the file or directory behind handle onto path, creating
+// the mount point first when it is hidden below /tmp.
+func bindWritable(handle int, path string) error {
+	defer unix.Close(handle)
+
+	var stat unix.Stat_t
+
+	err := unix.Fstat(handle, &stat)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Lstat(path); os.IsNotExist(err) {
+		if stat.Mode&unix.S_IFMT == unix.S_IFDIR {
+			err = os.MkdirAll(path, 0755)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return unix.Mount(fmt.Sprintf("/proc/self/fd/%d", handle), path, "", unix.MS_BIND|unix.MS_REC, "")
+}
+
+// remountAllReadOnly makes every mount read-only, apart from the mounts of
+// writable paths. Remounting only the root would leave mounts below it such
+// as /dev/shm or a separate /home writable.
+func remountAllReadOnly(writable []string) error {
+	mountPoints, err := readMountPoints("/proc/self/mountinfo")
+
+	if err != nil {
+		return err
+	}
+
+	for _, mountPoint := range mountPoints {
+		if isWithin(mountPoint, writable) {
+			continue
+		}
+
+		// Mount points which were removed or can't be looked up can't be
+		// reached by the shell either.
+		if _, err = os.Stat(mountPoint); err != nil {
+			continue
+		}
+
+		err = remountReadOnly(mountPoint)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMountPoints returns the mount points listed in a mountinfo file, parents
+// before the mounts below them.
+func readMountPoints(file string) ([]string, error) {
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read mounts")
+	}
+
+	var mountPoints []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+	}
+
+	return mountPoints, nil
+}
+
+// unescapeMountPoint decodes the octal escapes mountinfo uses for spaces, tabs,
+// newlines and backslashes.
+func unescapeMountPoint(mountPoint string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(mountPoint); i++ {
+		if mountPoint[i] == '\\' && i+3 < len(mountPoint) {
+			if code, err := strconv.ParseUint(mountPoint[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(mountPoint[i])
+	}
+
+	return b.String()
+}
+
+// remountReadOnly makes a mount point read-only. Flags like nosuid are locked
+// for mounts inherited by a user namespace and have to be passed again.
+func remountReadOnly(path string) error {
+	var stat unix.Statfs_t
+
+	err := unix.Statfs(path, &stat)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to stat %s", path)
+	}
+
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+
+	for statFlag, mountFlag := range map[int64]uintptr{
+		unix.ST_NOSUID:      unix.MS_NOSUID,
+		unix.ST_NODEV:       unix.MS_NODEV,
+		unix.ST_NOEXEC:      unix.MS_NOEXEC,
+		unix.ST_NOATIME:     unix.MS_NOATIME,
+		unix.ST_NODIRATIME:  unix.MS_NODIRATIME,
+		unix.ST_RELATIME:    unix.MS_RELATIME,
+		unix.ST_SYNCHRONOUS: unix.MS_SYNCHRONOUS,
+	} {
+		if int64(stat.Flags)&statFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+
+	// Atime flags are locked too, strictatime is what remains when neither
+	// noatime nor relatime is set.
+	if int64(stat.Flags)&(unix.ST_NOATIME|unix.ST_RELATIME) == 0 {
+		flags |= unix.MS_STRICTATIME
+	}
+
+	err = unix.Mount("", path, "", flags, "")
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to remount %s read-only", path)
+	}
+
+	return nil
+}
+
+func isWithin(path string, parents []string) bool {
+	for _, parent := range parents {
+		rel, err := filepath.Rel(parent, path)
+
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+
+	if err != nil {
+		return err
+	}
+
+	defer unix.Close(fd)
+
+	// struct ifreq: the interface name followed by the flags.
+	var request [40]byte
+	copy(request[:unix.IFNAMSIZ-1], "lo")
+	*(*uint16)(unsafe.Pointer(&request[unix.IFNAMSIZ])) = unix.IFF_UP | unix.IFF_RUNNING
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&request[0])))
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func execShell(argv []string) error {
+	path, err := exec.LookPath(argv[0])
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to find %s", argv[0])
+	}
+
+	env := make([]string, 0, len(os.Environ()))
+
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, sandboxSpecEnv+"=") {
+			env = append(env, variable)
+		}
+	}
+
+	err = syscall.Exec(path, argv, env)
+
+	return errors.Wrapf(err, "unable to run %s", path)
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if reexec.Init() {
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+func skipWithoutUserNamespaces(t *testing.T) {
+	err := exec.Command("unshare", "--user", "--map-root-user", "--mount", "true").Run()
+
+	if err != nil {
+		t.Skip("user namespaces are not available:", err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	skipWithoutUserNamespaces(t)
+
+	dir, err := ioutil.TempDir("", "cogs-sandbox")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	outside, err := ioutil.TempDir("", "cogs-sandbox-outside")
+	require.Nil(t, err)
+	defer os.RemoveAll(outside)
+
+	writable := filepath.Join(outside, "writable")
+	require.Nil(t, os.Mkdir(writable, 0755))
+
+	e := NewShellExecutor(dir, "/bin/sh", nil)
+	e.Sandbox = &SandboxConfig{WritablePaths: []string{writable}}
+
+	t.Run("Should allow writes to working directory and writable paths", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "touch here && touch "+writable+"/there && pwd\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, dir+"\n", output)
+		assert.FileExists(t, filepath.Join(dir, "here"))
+		assert.FileExists(t, filepath.Join(writable, "there"))
+	})
+
+	t.Run("Should make everything else read-only", func(t *testing.T) {
+		cwd, err := os.Getwd()
+		require.Nil(t, err)
+
+		file := filepath.Join(cwd, "cogs-sandbox-nope")
+		defer os.Remove(file)
+
+		_, exitCode := runTestScript(t, e, "touch "+file+" 2>/dev/null\n")
+
+		assert.NotEqual(t, 0, exitCode)
+		assert.NoFileExists(t, file)
+	})
+
+	t.Run("Should make mounts below the root read-only", func(t *testing.T) {
+		mountPoints, err := readMountPoints("/proc/self/mountinfo")
+		require.Nil(t, err)
+
+		var mount string
+
+		for _, mountPoint := range mountPoints {
+			if mountPoint == "/dev/shm" || mountPoint == "/run" {
+				mount = mountPoint
+				break
+			}
+		}
+
+		if mount == "" {
+			t.Skip("neither /dev/shm nor /run is a separate mount")
+		}
+
+		file := filepath.Join(mount, "cogs-sandbox-escaped")
+		defer os.Remove(file)
+
+		output, exitCode := runTestScript(t, e, "touch "+file+" 2>&1\n")
+
+		assert.NotEqual(t, 0, exitCode)
+		assert.Contains(t, output, "Read-only file system")
+		assert.NoFileExists(t, file)
+	})
+
+	t.Run("Should use a private /tmp", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "touch /tmp/cogs-sandbox-private && echo ok\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "ok\n", output)
+		assert.NoFileExists(t, "/tmp/cogs-sandbox-private")
+	})
+
+	t.Run("Should isolate processes and network", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "echo $$\ngrep -c : /proc/net/dev\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "1\n1\n", output)
+	})
+
+	t.Run("Should keep network when enabled", func(t *testing.T) {
+		e := NewShellExecutor(dir, "/bin/sh", nil)
+		e.Sandbox = &SandboxConfig{Network: true}
+
+		output, exitCode := runTestScript(t, e, "readlink /proc/1/ns/net\n")
+		host, err := os.Readlink("/proc/self/ns/net")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, host+"\n", output)
+	})
+}
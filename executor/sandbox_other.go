@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package executor
+
+import (
+	"github.com/pkg/errors"
+	"os/exec"
+)
+
+func sandboxCommand(_ string, _ []string, _ string, _ SandboxConfig) (*exec.Cmd, error) {
+	return nil, errors.New("sandbox is only supported on linux")
+}
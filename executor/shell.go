@@ -4,43 +4,96 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"io"
+	"io/ioutil"
+	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
+func init() {
+	Register(Shell, func(c Config) (Executor, error) {
+		e := NewShellExecutor(c.WorkingDirectory, c.Shell, c.ShellArgs)
+		e.Tty = c.Tty
+		e.Sandbox = c.Sandbox
+		e.Env = c.environment(filepath.Join(c.WorkingDirectory, c.OutputFile))
+
+		return e, nil
+	}, nil)
+}
+
+// outputGrace is how long output written before a shell exited may take to be
+// read. Processes the shell left running may still write after that, but
+// their output is no longer part of the session.
+const outputGrace = 100 * time.Millisecond
+
 type shellSession struct {
-	cmd    *exec.Cmd
-	stdout io.Reader
+	stdout *os.File
 	stdin  io.WriteCloser
+	group  *processGroup
 }
 
-func newShellSession(cmd *exec.Cmd) (*shellSession, error) {
-	stdout, err := cmd.StdoutPipe()
+func newShellSession(ctx context.Context, cmd *exec.Cmd) (*shellSession, error) {
+	stdin, err := cmd.StdinPipe()
 
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to pipe STDOUT")
+		return nil, errors.Wrap(err, "unable to pipe STDIN")
 	}
 
-	stdin, err := cmd.StdinPipe()
+	// Output is read from a plain pipe rather than StdoutPipe, which would be
+	// closed as soon as the shell exits and lose output still in flight.
+	stdout, writer, err := os.Pipe()
 
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to pipe STDIN")
+		return nil, errors.Wrap(err, "unable to pipe STDOUT")
 	}
 
+	cmd.Stdout = writer
+	setProcessGroup(cmd)
+
 	err = cmd.Start()
+	writer.Close()
 
 	if err != nil {
+		stdout.Close()
 		return nil, errors.Wrap(err, "unable to start shell")
 	}
 
 	return &shellSession{
-		cmd:    cmd,
 		stdout: stdout,
 		stdin:  stdin,
+		group: watchProcessGroup(ctx, cmd, func(*processGroup) {
+			endOutput(stdout)
+		}),
 	}, nil
 }
 
+// endOutput ends the output once what was written before the shell exited
+// was read, even when processes it started in the background still hold the
+// pipe.
+func endOutput(stdout *os.File) {
+	err := stdout.SetReadDeadline(time.Now().Add(outputGrace))
+
+	if err != nil {
+		stdout.Close()
+	}
+}
+
 func (s *shellSession) Reader() io.Reader {
-	return s.stdout
+	return s
+}
+
+func (s *shellSession) Read(p []byte) (int, error) {
+	n, err := s.stdout.Read(p)
+
+	if os.IsTimeout(err) {
+		return n, io.EOF
+	}
+
+	return n, err
 }
 
 func (s *shellSession) Writer() io.Writer {
@@ -57,20 +110,37 @@ func (s *shellSession) CloseWrite() error {
 	return nil
 }
 
-func (s *shellSession) End(_ context.Context) (int, error) {
-	err := s.cmd.Wait()
+// End waits for the shell. The output pipe is drained until the processes
+// left running exit, so that they don't fail writing to it.
+func (s *shellSession) End(ctx context.Context) (int, error) {
+	defer func() {
+		go func() {
+			_ = s.stdout.SetReadDeadline(time.Time{})
+			_, _ = io.Copy(ioutil.Discard, s.stdout)
+			s.stdout.Close()
+		}()
+	}()
 
-	if err != nil {
-		return -1, errors.Wrap(err, "error while waiting for process to end")
-	}
+	return s.group.wait(ctx)
+}
 
-	return s.cmd.ProcessState.ExitCode(), nil
+// SandboxConfig isolates shell sessions from the host on Linux. The root
+// file system is read-only apart from the working directory and WritablePaths,
+// /tmp is private and the network is disabled unless Network is set.
+type SandboxConfig struct {
+	WritablePaths []string
+	Network       bool
 }
 
 type ShellExecutor struct {
 	Shell            string
 	ShellArguments   []string
 	WorkingDirectory string
+	Tty              bool
+	Sandbox          *SandboxConfig
+	Env              []string
+	lock             sync.Mutex
+	groups           []*processGroup
 }
 
 func (s *ShellExecutor) Name() string {
@@ -81,18 +151,157 @@ func NewShellExecutor(workingDirectory, shell string, shellArguments []string) *
 	return &ShellExecutor{WorkingDirectory: workingDirectory, Shell: shell, ShellArguments: shellArguments}
 }
 
-func (s *ShellExecutor) Session(_ context.Context) (Session, error) {
-	cmd := exec.Command(s.Shell, s.ShellArguments...)
+func (s *ShellExecutor) command(args []string) (*exec.Cmd, error) {
+	if s.Sandbox != nil {
+		cmd, err := sandboxCommand(s.Shell, args, s.WorkingDirectory, *s.Sandbox)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cmd.Env = append(cmd.Env, s.Env...)
+
+		return cmd, nil
+	}
+
+	cmd := exec.Command(s.Shell, args...)
 	cmd.Dir = s.WorkingDirectory
-	session, err := newShellSession(cmd)
+
+	if len(s.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.Env...)
+	}
+
+	return cmd, nil
+}
+
+func (s *ShellExecutor) Session(ctx context.Context) (Session, error) {
+	cmd, err := s.command(s.ShellArguments)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to start session")
+	}
+
+	if s.Tty {
+		return newTtyShellSession(ctx, cmd), nil
+	}
+
+	session, err := newShellSession(ctx, cmd)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to start session")
 	}
 
+	s.lock.Lock()
+	s.groups = append(s.groups, session.group)
+	s.lock.Unlock()
+
 	return session, nil
 }
 
+func (s *ShellExecutor) Interactive(_ context.Context) error {
+	cmd, err := s.command(nil)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to run interactive shell")
+	}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return errors.Wrap(err, "unable to run interactive shell")
+	}
+
+	return nil
+}
+
+// Close kills the processes sessions left running, such as services started
+// in the background by before_script.
 func (s *ShellExecutor) Close(_ context.Context) error {
+	s.lock.Lock()
+	groups := s.groups
+	s.groups = nil
+	s.lock.Unlock()
+
+	for _, group := range groups {
+		group.killLeftovers()
+	}
+
 	return nil
 }
+
+// processGroup watches a shell running in its own process group. The whole
+// group is killed when the context is done, otherwise exited is called once
+// the shell exits.
+type processGroup struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+func watchProcessGroup(ctx context.Context, cmd *exec.Cmd, exited func(g *processGroup)) *processGroup {
+	g := &processGroup{cmd: cmd, done: make(chan struct{})}
+	waited := make(chan error, 1)
+
+	go func() {
+		waited <- cmd.Wait()
+	}()
+
+	go func() {
+		defer close(g.done)
+
+		select {
+		case g.err = <-waited:
+			exited(g)
+		case <-ctx.Done():
+			g.kill()
+			<-waited
+			g.err = ctx.Err()
+		}
+	}()
+
+	return g
+}
+
+func (g *processGroup) killLeftovers() {
+	leftovers := processGroupMembers(g.cmd)
+
+	if len(leftovers) == 0 {
+		return
+	}
+
+	log.Printf("Killing %d leftover processes:\n  %s\n", len(leftovers), strings.Join(leftovers, "\n  "))
+	g.kill()
+}
+
+// kill kills the process group and gives its members a moment to exit.
+func (g *processGroup) kill() {
+	err := killProcessGroup(g.cmd)
+
+	if err != nil {
+		log.Println("Unable to kill process group", err)
+		return
+	}
+
+	for i := 0; i < 100 && len(processGroupMembers(g.cmd)) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (g *processGroup) wait(ctx context.Context) (int, error) {
+	select {
+	case <-g.done:
+	case <-ctx.Done():
+		g.kill()
+		<-g.done
+	}
+
+	if _, exited := g.err.(*exec.ExitError); g.err != nil && !exited {
+		return -1, errors.Wrap(g.err, "error while waiting for process to end")
+	}
+
+	return g.cmd.ProcessState.ExitCode(), nil
+}
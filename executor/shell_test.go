@@ -0,0 +1,106 @@
+//go:build !windows
+// +build !windows
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processAlive reports whether a process exists and has not exited yet.
+// Orphans may linger as zombies when nothing reaps them.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+
+	stat, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+
+	if err != nil {
+		return true
+	}
+
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+
+	return fields[0] != "Z"
+}
+
+func readPid(t *testing.T, file string) int {
+	content, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	require.Nil(t, err)
+
+	return pid
+}
+
+func TestShellExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-shell")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := NewShellExecutor(dir, "/bin/sh", nil)
+
+	t.Run("Should kill processes left behind by scripts when closed", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "sleep 300 &\necho $! > pid\necho done\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "done\n", output)
+
+		pid := readPid(t, filepath.Join(dir, "pid"))
+		assert.True(t, processAlive(pid))
+
+		output, exitCode = runTestScript(t, e, "kill -0 $(cat pid) && echo running\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "running\n", output)
+
+		assert.Nil(t, e.Close(context.Background()))
+		assert.False(t, processAlive(pid))
+	})
+
+	t.Run("Should end the output of a script while processes it left write to it", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "(while true; do echo tick; sleep 0.01; done) &\necho $! > pid\necho done\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.True(t, strings.Contains(output, "done\n"))
+
+		pid := readPid(t, filepath.Join(dir, "pid"))
+		assert.True(t, processAlive(pid))
+
+		assert.Nil(t, e.Close(context.Background()))
+		assert.False(t, processAlive(pid))
+	})
+
+	t.Run("Should kill the process group when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		session, err := e.Session(ctx)
+		require.Nil(t, err)
+
+		_, err = session.Writer().Write([]byte("sleep 301 &\necho $! > pid\nsleep 302\n"))
+		require.Nil(t, err)
+		require.Nil(t, session.CloseWrite())
+
+		_, err = ioutil.ReadAll(session.Reader())
+		assert.Nil(t, err)
+
+		_, err = session.End(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+		assert.False(t, processAlive(readPid(t, filepath.Join(dir, "pid"))))
+	})
+}
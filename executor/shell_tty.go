@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// ttyShellSession runs a script on a pseudo-terminal. A shell reading its
+// script from a terminal turns interactive, so the script is buffered and
+// handed to the shell with -c once CloseWrite is called.
+type ttyShellSession struct {
+	ctx        context.Context
+	cmd        *exec.Cmd
+	group      *processGroup
+	script     bytes.Buffer
+	output     *io.PipeReader
+	pipe       *io.PipeWriter
+	master     *os.File
+	stopResize func()
+}
+
+func newTtyShellSession(ctx context.Context, cmd *exec.Cmd) *ttyShellSession {
+	reader, writer := io.Pipe()
+
+	return &ttyShellSession{
+		ctx:        ctx,
+		cmd:        cmd,
+		output:     reader,
+		pipe:       writer,
+		stopResize: func() {},
+	}
+}
+
+func (s *ttyShellSession) Reader() io.Reader {
+	return s.output
+}
+
+func (s *ttyShellSession) Writer() io.Writer {
+	return &s.script
+}
+
+func (s *ttyShellSession) CloseWrite() error {
+	s.cmd.Args = append(s.cmd.Args, "-c", s.script.String())
+
+	master, err := startTty(s.cmd)
+
+	if err != nil {
+		s.pipe.CloseWithError(err)
+		return errors.Wrap(err, "unable to start script")
+	}
+
+	s.master = master
+	// The terminal is hung up once the shell exits, so processes it left
+	// running are killed along with the session.
+	s.group = watchProcessGroup(s.ctx, s.cmd, func(g *processGroup) {
+		g.killLeftovers()
+	})
+	s.stopResize = watchTerminalSize(resizeTty(master))
+
+	go func() {
+		_, err := io.Copy(s.pipe, ptyReader{master})
+		s.pipe.CloseWithError(err)
+	}()
+
+	return nil
+}
+
+func (s *ttyShellSession) End(ctx context.Context) (int, error) {
+	if s.master == nil {
+		return -1, errors.New("session was not started")
+	}
+
+	defer s.master.Close()
+	defer s.stopResize()
+
+	return s.group.wait(ctx)
+}
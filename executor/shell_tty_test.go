@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTtyShellSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-tty")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := NewShellExecutor(dir, "/bin/sh", nil)
+	e.Tty = true
+
+	t.Run("Should run the script on a terminal", func(t *testing.T) {
+		output, exitCode := runTestScript(t, e, "test -t 0 && test -t 1 && echo on a tty\nexit 3\n")
+
+		assert.Equal(t, 3, exitCode)
+		assert.Equal(t, "on a tty\r\n", output)
+	})
+
+	t.Run("Should kill the script when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		session, err := e.Session(ctx)
+		require.Nil(t, err)
+
+		_, err = session.Writer().Write([]byte("sleep 303\n"))
+		require.Nil(t, err)
+		require.Nil(t, session.CloseWrite())
+
+		_, err = ioutil.ReadAll(session.Reader())
+		assert.Nil(t, err)
+
+		_, err = session.End(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	})
+}
+
+func TestStartTty(t *testing.T) {
+	t.Run("Should run the command on a pseudo-terminal", func(t *testing.T) {
+		cmd := exec.Command("/bin/sh", "-c", "tty")
+
+		master, err := startTty(cmd)
+		require.Nil(t, err)
+		defer master.Close()
+
+		output, err := ioutil.ReadAll(ptyReader{master})
+		assert.Nil(t, err)
+		assert.Nil(t, cmd.Wait())
+
+		assert.True(t, strings.HasPrefix(string(output), "/dev/"))
+		assert.True(t, strings.HasSuffix(string(output), "\r\n"))
+	})
+}
@@ -0,0 +1,472 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultSSHPort = 22
+
+func init() {
+	Register(SSH, func(c Config) (Executor, error) {
+		e := NewSSHExecutor(c.WorkingDirectory, c.Shell, c.ShellArgs, c.SSH)
+		e.env = c.environment(`"$PWD"/` + utils.ShellQuote(filepath.ToSlash(c.OutputFile)))
+		e.outputFile = filepath.ToSlash(c.OutputFile)
+		e.task = c.Task
+		e.events = c.Events
+
+		return e, nil
+	}, noSandbox(validateSSH))
+}
+
+func validateSSH(task cogsfile.Task) error {
+	err := validateSSHConfig(task.SSH)
+
+	if err != nil {
+		return errors.Wrap(err, "invalid ssh configuration")
+	}
+
+	return nil
+}
+
+func validateSSHConfig(config cogsfile.SSHConfig) error {
+	if config.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if config.User == "" {
+		return errors.New("user is required")
+	}
+
+	if config.Key == "" {
+		return errors.New("key is required")
+	}
+
+	if config.Port < 0 || config.Port > 65535 {
+		return errors.Errorf("invalid port: %d", config.Port)
+	}
+
+	return nil
+}
+
+type SSHConfig struct {
+	Host                  string
+	Port                  int
+	User                  string
+	KeyFile               string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	RemoteDir             string
+	Outputs               []string
+}
+
+type sshSession struct {
+	ctx     context.Context
+	session *ssh.Session
+	stdout  io.Reader
+	stdin   io.WriteCloser
+	done    chan struct{}
+}
+
+// newSSHSession signals the remote command to be killed and closes the session
+// once ctx is done, which ends its output.
+func newSSHSession(ctx context.Context, session *ssh.Session, stdout io.Reader, stdin io.WriteCloser) *sshSession {
+	s := &sshSession{ctx: ctx, session: session, stdout: stdout, stdin: stdin, done: make(chan struct{})}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = session.Signal(ssh.SIGKILL)
+			_ = session.Close()
+		case <-s.done:
+		}
+	}()
+
+	return s
+}
+
+func (s *sshSession) Reader() io.Reader {
+	return s.stdout
+}
+
+func (s *sshSession) Writer() io.Writer {
+	return s.stdin
+}
+
+func (s *sshSession) CloseWrite() error {
+	err := s.stdin.Close()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to close IO")
+	}
+
+	return nil
+}
+
+func (s *sshSession) End(_ context.Context) (int, error) {
+	defer s.session.Close()
+
+	err := s.session.Wait()
+	close(s.done)
+
+	if s.ctx.Err() != nil {
+		return -1, errors.Wrap(s.ctx.Err(), "error while waiting for remote command to end")
+	}
+
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus(), nil
+	}
+
+	if err != nil {
+		return -1, errors.Wrap(err, "error while waiting for remote command to end")
+	}
+
+	return 0, nil
+}
+
+// SSHExecutor runs tasks on a remote machine. The working directory is copied
+// to the remote directory before the first session and declared outputs are
+// copied back when the executor is closed. The remote machine needs tar and dd.
+type SSHExecutor struct {
+	config           SSHConfig
+	workingDirectory string
+	shell            string
+	shellArgs        []string
+	env              []string
+	outputFile       string
+	task             string
+	events           *events.Bus
+	client           *ssh.Client
+}
+
+func NewSSHExecutor(workingDirectory, shell string, args []string, config SSHConfig) *SSHExecutor {
+	return &SSHExecutor{
+		config:           config,
+		workingDirectory: workingDirectory,
+		shell:            shell,
+		shellArgs:        args,
+	}
+}
+
+func (e *SSHExecutor) Name() string {
+	return "ssh"
+}
+
+func (e *SSHExecutor) connect() error {
+	signer, err := loadSigner(e.config.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	hostKeyCallback, err := e.hostKeyCallback()
+
+	if err != nil {
+		return err
+	}
+
+	port := e.config.Port
+
+	if port == 0 {
+		port = defaultSSHPort
+	}
+
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(port))
+
+	log.Printf("Connecting to %s@%s\n", e.config.User, address)
+
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            e.config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	})
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to connect to %s", address)
+	}
+
+	e.client = client
+	return nil
+}
+
+func loadSigner(keyFile string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(utils.ExpandHome(keyFile))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read private key")
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse private key")
+	}
+
+	return signer, nil
+}
+
+func (e *SSHExecutor) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if e.config.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	file := e.config.KnownHostsFile
+
+	if file == "" {
+		file = "~/.ssh/known_hosts"
+	}
+
+	callback, err := knownhosts.New(utils.ExpandHome(file))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read known hosts")
+	}
+
+	return callback, nil
+}
+
+func (e *SSHExecutor) syncToRemote() error {
+	log.Printf("Syncing %s to %s\n", e.workingDirectory, e.config.RemoteDir)
+
+	session, err := e.client.NewSession()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to open ssh session")
+	}
+
+	defer session.Close()
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(writeTar(writer, e.workingDirectory, []string{StateDir}))
+	}()
+
+	var stderr bytes.Buffer
+	session.Stdin = reader
+	session.Stderr = &stderr
+
+	remoteDir := utils.ShellQuote(e.config.RemoteDir)
+	command := fmt.Sprintf("mkdir -p %s && tar -xf - -C %s", remoteDir, remoteDir)
+
+	// The state directory isn't synced, so the output file is created empty
+	// once per run rather than once per session.
+	if e.outputFile != "" {
+		outputFile := utils.ShellQuote(path.Join(e.config.RemoteDir, e.outputFile))
+		command += fmt.Sprintf(" && mkdir -p $(dirname %s) && : > %s", outputFile, outputFile)
+	}
+
+	err = session.Run(command)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to sync working directory: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (e *SSHExecutor) syncFromRemote(outputs []string) error {
+	log.Printf("Syncing outputs %s from %s\n", strings.Join(outputs, ", "), e.config.RemoteDir)
+
+	session, err := e.client.NewSession()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to open ssh session")
+	}
+
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to pipe STDOUT")
+	}
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	err = session.Start(fmt.Sprintf("cd %s && tar -cf - %s", utils.ShellQuote(e.config.RemoteDir), utils.ShellJoin(outputs)))
+
+	if err != nil {
+		return errors.Wrap(err, "unable to archive outputs")
+	}
+
+	err = extractTar(stdout, e.workingDirectory)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to extract outputs")
+	}
+
+	err = session.Wait()
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to archive outputs: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// CopyArtifact copies a file or directory from the remote host. Relative
+// paths are resolved against the remote directory.
+func (e *SSHExecutor) CopyArtifact(_ context.Context, path, dst string) error {
+	if e.client == nil {
+		return errors.New("not connected")
+	}
+
+	session, err := e.client.NewSession()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to open ssh session")
+	}
+
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to pipe STDOUT")
+	}
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	parent, name, storeDir := ArtifactPath(path)
+	parent = utils.StringOrDefault(filepath.ToSlash(parent), ".")
+
+	err = session.Start(fmt.Sprintf("cd %s && tar -C %s -cf - %s",
+		utils.ShellQuote(e.config.RemoteDir), utils.ShellQuote(parent), utils.ShellQuote(name)))
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to archive artifact %s", path)
+	}
+
+	err = extractTar(stdout, filepath.Join(dst, storeDir))
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to extract artifact %s", path)
+	}
+
+	err = session.Wait()
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to archive artifact %s: %s", path, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (e *SSHExecutor) Session(ctx context.Context) (Session, error) {
+	if e.client == nil {
+		err := publishStep(e.events, e.task, e.Name(), events.Connect, e.connect)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating session")
+		}
+
+		err = publishStep(e.events, e.task, e.Name(), events.Sync, e.syncToRemote)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating session")
+		}
+	}
+
+	session, err := e.client.NewSession()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open ssh session")
+	}
+
+	stdout, err := session.StdoutPipe()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to pipe STDOUT")
+	}
+
+	stdin, err := session.StdinPipe()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to pipe STDIN")
+	}
+
+	cmd := "exec " + utils.ShellJoin(makeCommand(e.shell, e.shellArgs))
+	exports := e.exports()
+
+	// Variables may hold secrets, so they are read from STDIN before the
+	// script instead of being put on the command line, which other users of
+	// the remote host can see.
+	if exports != "" {
+		cmd = fmt.Sprintf(`eval "$(dd bs=1 count=%d 2>/dev/null)" && %s`, len(exports), cmd)
+	}
+
+	err = session.Start(fmt.Sprintf("cd %s && %s 2>&1", utils.ShellQuote(e.config.RemoteDir), cmd))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to start remote shell")
+	}
+
+	_, err = io.WriteString(stdin, exports)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to send variables")
+	}
+
+	return newSSHSession(ctx, session, stdout, stdin), nil
+}
+
+// exports returns a script exporting the task variables. COGS_OUTPUT is left
+// unquoted since it refers to $PWD, which only the remote shell knows.
+func (e *SSHExecutor) exports() string {
+	var exports strings.Builder
+
+	for _, variable := range e.env {
+		parts := strings.SplitN(variable, "=", 2)
+		value := parts[1]
+
+		if parts[0] != OutputEnv {
+			value = utils.ShellQuote(value)
+		}
+
+		exports.WriteString("export " + parts[0] + "=" + value + "\n")
+	}
+
+	return exports.String()
+}
+
+func (e *SSHExecutor) Close(_ context.Context) error {
+	if e.client == nil {
+		return nil
+	}
+
+	defer e.client.Close()
+
+	outputs := e.config.Outputs
+
+	if e.outputFile != "" {
+		outputs = append(outputs[:len(outputs):len(outputs)], e.outputFile)
+	}
+
+	if len(outputs) > 0 {
+		err := e.syncFromRemote(outputs)
+
+		if err != nil {
+			return errors.Wrap(err, "error syncing outputs")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package executor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSSHServer accepts a single client key and runs exec requests with the
+// local /bin/sh, which is enough to drive SSHExecutor end to end.
+type testSSHServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	mutex    sync.Mutex
+	commands []string
+}
+
+func newTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) *testSSHServer {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	server := &testSSHServer{listener: listener, config: config}
+
+	go server.serve()
+
+	return server
+}
+
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		channel, requests, err := newChannel.Accept()
+
+		if err != nil {
+			continue
+		}
+
+		go s.handleSession(channel, requests)
+	}
+}
+
+func (s *testSSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			_ = request.Reply(false, nil)
+			continue
+		}
+
+		length := binary.BigEndian.Uint32(request.Payload)
+		command := string(request.Payload[4 : 4+length])
+		_ = request.Reply(true, nil)
+
+		s.mutex.Lock()
+		s.commands = append(s.commands, command)
+		s.mutex.Unlock()
+
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+
+		status := uint32(0)
+
+		if err := cmd.Run(); err != nil {
+			status = 255
+
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, status)
+		_, _ = channel.SendRequest("exit-status", false, payload)
+
+		return
+	}
+}
+
+func TestSSHExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-ssh")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, hostPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPrivate)
+	require.Nil(t, err)
+
+	_, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	clientKey, err := ssh.NewSignerFromKey(clientPrivate)
+	require.Nil(t, err)
+
+	server := newTestSSHServer(t, hostKey, clientKey.PublicKey())
+	defer server.listener.Close()
+
+	address := server.listener.Addr().(*net.TCPAddr)
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.Nil(t, ioutil.WriteFile(keyFile, marshalPrivateKey(t, clientPrivate), 0600))
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	knownHostsLine := knownhosts.Line([]string{address.String()}, hostKey.PublicKey())
+	require.Nil(t, ioutil.WriteFile(knownHostsFile, []byte(knownHostsLine+"\n"), 0600))
+
+	workingDirectory := filepath.Join(dir, "local")
+	require.Nil(t, os.MkdirAll(filepath.Join(workingDirectory, "src"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(workingDirectory, "src", "input.txt"), []byte("from local"), 0644))
+
+	config := SSHConfig{
+		Host:           "127.0.0.1",
+		Port:           address.Port,
+		User:           "cogs",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHostsFile,
+		RemoteDir:      filepath.Join(dir, "remote"),
+		Outputs:        []string{"out"},
+	}
+
+	t.Run("Should sync working directory and outputs", func(t *testing.T) {
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", []string{"-e"}, config)
+
+		output, exitCode := runTestScript(t, e, "cat src/input.txt\nmkdir -p out\necho built > out/result.txt\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "from local", output)
+
+		require.Nil(t, e.Close(context.Background()))
+
+		result, err := ioutil.ReadFile(filepath.Join(workingDirectory, "out", "result.txt"))
+		assert.Nil(t, err)
+		assert.Equal(t, "built\n", string(result))
+	})
+
+	t.Run("Should return exit code of failed script", func(t *testing.T) {
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", []string{"-e"}, SSHConfig{
+			Host:           config.Host,
+			Port:           config.Port,
+			User:           config.User,
+			KeyFile:        config.KeyFile,
+			KnownHostsFile: config.KnownHostsFile,
+			RemoteDir:      config.RemoteDir,
+		})
+
+		output, exitCode := runTestScript(t, e, "echo failing >&2\nexit 3\necho unreachable\n")
+
+		assert.Equal(t, 3, exitCode)
+		assert.Equal(t, "failing\n", output)
+		assert.Nil(t, e.Close(context.Background()))
+	})
+
+	t.Run("Should copy artifacts from the remote host", func(t *testing.T) {
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", []string{"-e"}, config)
+
+		_, exitCode := runTestScript(t, e, "mkdir -p bin\necho app > bin/app\n")
+		require.Equal(t, 0, exitCode)
+
+		store := filepath.Join(dir, "artifacts")
+
+		assert.Nil(t, CopyArtifact(context.Background(), e, workingDirectory, "bin/app", store))
+		assert.Nil(t, CopyArtifact(context.Background(), e, workingDirectory, filepath.Join(dir, "remote", "bin"), store))
+		assert.Nil(t, e.Close(context.Background()))
+
+		app, err := ioutil.ReadFile(filepath.Join(store, "bin", "app"))
+		assert.Nil(t, err)
+		assert.Equal(t, "app\n", string(app))
+		assert.NoFileExists(t, filepath.Join(workingDirectory, "bin", "app"))
+	})
+
+	t.Run("Should pass variables over STDIN", func(t *testing.T) {
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", []string{"-e"}, config)
+		e.env = []string{"TOKEN=s3cret 'quoted'\nline", OutputEnv + `="$PWD"/'.cogs/output'`}
+
+		output, exitCode := runTestScript(t, e, "printf '%s|%s' \"$TOKEN\" \"$COGS_OUTPUT\"\n")
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "s3cret 'quoted'\nline|"+filepath.Join(dir, "remote", ".cogs", "output"), output)
+		assert.Nil(t, e.Close(context.Background()))
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		for _, command := range server.commands {
+			assert.NotContains(t, command, "s3cret")
+		}
+	})
+
+	t.Run("Should end the session when cancelled", func(t *testing.T) {
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", nil, config)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		session, err := e.Session(ctx)
+		require.Nil(t, err)
+
+		_, err = session.Writer().Write([]byte("sleep 30\n"))
+		require.Nil(t, err)
+		require.Nil(t, session.CloseWrite())
+
+		started := time.Now()
+
+		_, err = ioutil.ReadAll(session.Reader())
+		assert.Nil(t, err)
+
+		_, err = session.End(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+		assert.True(t, time.Since(started) < 10*time.Second)
+	})
+
+	t.Run("Should reject unknown host keys", func(t *testing.T) {
+		otherHosts := filepath.Join(dir, "other_known_hosts")
+		require.Nil(t, ioutil.WriteFile(otherHosts, nil, 0600))
+
+		e := NewSSHExecutor(workingDirectory, "/bin/sh", nil, SSHConfig{
+			Host:           config.Host,
+			Port:           config.Port,
+			User:           config.User,
+			KeyFile:        config.KeyFile,
+			KnownHostsFile: otherHosts,
+			RemoteDir:      config.RemoteDir,
+		})
+
+		_, err := e.Session(context.Background())
+
+		assert.NotNil(t, err)
+	})
+}
+
+func marshalPrivateKey(t *testing.T, key ed25519.PrivateKey) []byte {
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bytes})
+}
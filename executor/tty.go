@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package executor
+
+import (
+	"github.com/creack/pty"
+	"github.com/docker/docker/pkg/term"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// stdinPollInterval is how often, in milliseconds, copyStdin checks whether it
+// was stopped while waiting for input.
+const stdinPollInterval = 100
+
+// watchTerminalSize calls resize with the size of the terminal attached to
+// stdout, once immediately and again whenever the window changes. Nothing
+// happens when stdout is not a terminal. The returned function stops watching.
+func watchTerminalSize(resize func(size *term.Winsize)) func() {
+	fd := os.Stdout.Fd()
+
+	if !term.IsTerminal(fd) {
+		return func() {}
+	}
+
+	update := func() {
+		size, err := term.GetWinsize(fd)
+
+		if err == nil {
+			resize(size)
+		}
+	}
+
+	update()
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				update()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// copyStdin copies stdin to w until the returned function is called, which
+// waits for the copy to stop. Stdin is only read once input is available, so
+// that no input is consumed after the copy was stopped.
+func copyStdin(w io.Writer) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		fds := []unix.PollFd{{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN}}
+		buffer := make([]byte, 32*1024)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			ready, err := unix.Poll(fds, stdinPollInterval)
+
+			if err == unix.EINTR || (err == nil && ready == 0) {
+				continue
+			}
+
+			if err != nil {
+				return
+			}
+
+			n, err := os.Stdin.Read(buffer)
+
+			if n > 0 {
+				_, writeErr := w.Write(buffer[:n])
+
+				if writeErr != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// ptyReader translates the EIO returned by a pseudo-terminal master once all
+// processes holding the terminal have exited into io.EOF.
+type ptyReader struct {
+	master *os.File
+}
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.master.Read(p)
+
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EIO {
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+func resizeTty(master *os.File) func(size *term.Winsize) {
+	return func(size *term.Winsize) {
+		_ = term.SetWinsize(master.Fd(), size)
+	}
+}
+
+func startTty(cmd *exec.Cmd) (*os.File, error) {
+	master, tty, err := pty.Open()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open pseudo-terminal")
+	}
+
+	defer tty.Close()
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+
+	err = cmd.Start()
+
+	if err != nil {
+		master.Close()
+		return nil, errors.Wrap(err, "unable to start shell")
+	}
+
+	return master, nil
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package executor
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is written to by a goroutine while the test reads it.
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.String()
+}
+
+func TestCopyStdin(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.Nil(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	t.Run("Should stop copying without consuming further input", func(t *testing.T) {
+		var output lockedBuffer
+		stop := copyStdin(&output)
+
+		_, err := writer.Write([]byte("ls\n"))
+		require.Nil(t, err)
+
+		assert.Eventually(t, func() bool { return output.String() == "ls\n" }, time.Second, 10*time.Millisecond)
+
+		stop()
+
+		_, err = writer.Write([]byte("exit\n"))
+		require.Nil(t, err)
+
+		left := make([]byte, 16)
+		n, err := reader.Read(left)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "exit\n", string(left[:n]))
+		assert.Equal(t, "ls\n", output.String())
+	})
+}
@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"github.com/docker/docker/pkg/term"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+func watchTerminalSize(_ func(size *term.Winsize)) func() {
+	return func() {}
+}
+
+// copyStdin copies stdin to w. A pending read of stdin can't be cancelled, so
+// the returned function returns without waiting for the copy to stop.
+func copyStdin(w io.Writer) func() {
+	go func() {
+		_, _ = io.Copy(w, os.Stdin)
+	}()
+
+	return func() {}
+}
+
+type ptyReader struct {
+	master *os.File
+}
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func resizeTty(_ *os.File) func(size *term.Winsize) {
+	return func(_ *term.Winsize) {}
+}
+
+func startTty(_ *exec.Cmd) (*os.File, error) {
+	return nil, errors.New("pseudo-terminals are not supported on windows")
+}
@@ -0,0 +1,275 @@
+package history
+
+import (
+	"encoding/json"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Run is the record of a run kept in the history.
+type Run struct {
+	ID       string    `json:"id"`
+	Target   string    `json:"target"`
+	Commit   string    `json:"commit,omitempty"`
+	Dirty    bool      `json:"dirty,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Tasks    []Task    `json:"tasks"`
+}
+
+func (r Run) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// SameCommit reports whether the run was on a clean working tree of the given
+// commit, and the working tree is clean now too.
+func (r Run) SameCommit(commit string, dirty bool) bool {
+	return r.Commit != "" && !r.Dirty && !dirty && r.Commit == commit
+}
+
+// Task returns the record of the task with the given name.
+func (r Run) Task(name string) (Task, bool) {
+	for _, task := range r.Tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+
+	return Task{}, false
+}
+
+// Task is the record of a task of a run. The fingerprint identifies the
+// inputs of the task, it is the key the task is cached under.
+type Task struct {
+	Name        string        `json:"name"`
+	Executor    string        `json:"executor,omitempty"`
+	Status      string        `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	ExitCode    *int          `json:"exit_code,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Phases      []Phase       `json:"phases,omitempty"`
+}
+
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	ExitCode *int          `json:"exit_code,omitempty"`
+}
+
+// FromReport creates the record of a run from its outcome.
+func FromReport(run *report.Run, commit string) Run {
+	record := Run{
+		ID:       run.ID,
+		Target:   run.Target,
+		Commit:   commit,
+		Started:  run.Started,
+		Finished: run.Finished,
+		Status:   string(run.Status()),
+		Error:    run.Error,
+		Tasks:    make([]Task, 0, len(run.Tasks)),
+	}
+
+	for _, task := range run.Tasks {
+		t := Task{
+			Name:        task.Name,
+			Executor:    task.Executor,
+			Status:      string(task.Status()),
+			Reason:      task.Reason,
+			Fingerprint: task.Fingerprint,
+			Error:       task.Error,
+		}
+
+		if !task.Started.IsZero() && !task.Finished.IsZero() {
+			t.Duration = task.Duration()
+		}
+
+		for _, phase := range task.Phases {
+			p := Phase{Name: phase.Name, ExitCode: phase.ExitCode}
+
+			if !phase.Finished.IsZero() {
+				p.Duration = phase.Duration()
+			}
+
+			// The exit code of a task is that of the phase which failed it,
+			// or else that of its script.
+			if phase.ExitCode != nil && (t.ExitCode == nil || *t.ExitCode == 0) {
+				t.ExitCode = phase.ExitCode
+			}
+
+			t.Phases = append(t.Phases, p)
+		}
+
+		record.Tasks = append(record.Tasks, t)
+	}
+
+	return record
+}
+
+// Store keeps the records of runs in a directory, a JSON file per run named
+// after its ID. IDs start with the time of the run, so their order is that
+// of the runs.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) Save(run Run) error {
+	err := os.MkdirAll(s.dir, 0755)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to create history directory")
+	}
+
+	content, err := json.MarshalIndent(run, "", "  ")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to encode run")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(s.dir, run.ID+".json"), content, 0644)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write run")
+	}
+
+	return nil
+}
+
+// List returns the recorded runs, the most recent first.
+func (s *Store) List() ([]Run, error) {
+	ids, err := s.ids()
+
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]Run, 0, len(ids))
+
+	for _, id := range ids {
+		run, err := s.read(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, *run)
+	}
+
+	return runs, nil
+}
+
+// Get returns the run with the given ID, or the only run whose ID starts
+// with it.
+func (s *Store) Get(id string) (*Run, error) {
+	ids, err := s.ids()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+
+	for _, candidate := range ids {
+		if candidate == id {
+			return s.read(id)
+		}
+
+		if strings.HasPrefix(candidate, id) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, errors.Errorf("run %s not found", id)
+	case 1:
+		return s.read(matches[0])
+	default:
+		return nil, errors.Errorf("run %s is ambiguous, it matches %d runs", id, len(matches))
+	}
+}
+
+// Last returns the most recent run, or nil if no run was recorded.
+func (s *Store) Last() (*Run, error) {
+	ids, err := s.ids()
+
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	return s.read(ids[0])
+}
+
+// Prune removes all but the most recent runs.
+func (s *Store) Prune(keep int) error {
+	ids, err := s.ids()
+
+	if err != nil {
+		return err
+	}
+
+	for i := keep; i < len(ids); i++ {
+		err = os.Remove(filepath.Join(s.dir, ids[i]+".json"))
+
+		if err != nil {
+			return errors.Wrap(err, "unable to remove run")
+		}
+	}
+
+	return nil
+}
+
+// ids returns the IDs of the recorded runs, the most recent first.
+func (s *Store) ids() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read history")
+	}
+
+	var ids []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	return ids, nil
+}
+
+func (s *Store) read(id string) (*Run, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, id+".json"))
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read run %s", id)
+	}
+
+	run := &Run{}
+	err = json.Unmarshal(content, run)
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decode run %s", id)
+	}
+
+	return run, nil
+}
@@ -0,0 +1,131 @@
+package history
+
+import (
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/kinematic-ci/cogs/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFromReport(t *testing.T) {
+	t.Run("Should record tasks with their fingerprints and exit codes", func(t *testing.T) {
+		start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+		c := report.NewCollector()
+
+		for _, event := range []events.Event{
+			{Type: events.RunStarted, Time: start, Run: "20201001-120000.000-abcdef", Target: "deploy"},
+			{Type: events.TaskPlanned, Time: start, Task: "build", Executor: "docker"},
+			{Type: events.TaskPlanned, Time: start, Task: "deploy", Executor: "shell"},
+			{Type: events.TaskSkipped, Time: start, Task: "lint", Fingerprint: "f1", Reason: "cached"},
+			{Type: events.TaskStarted, Time: start, Task: "build", Fingerprint: "f2"},
+			{Type: events.PhaseStarted, Time: start, Task: "build", Phase: events.Script},
+			events.Event{Type: events.PhaseFinished, Time: start.Add(time.Second), Task: "build", Phase: events.Script}.WithExitCode(2),
+			{Type: events.PhaseStarted, Time: start.Add(time.Second), Task: "build", Phase: events.AfterScript},
+			events.Event{Type: events.PhaseFinished, Time: start.Add(2 * time.Second), Task: "build", Phase: events.AfterScript}.WithExitCode(0),
+			{Type: events.TaskFinished, Time: start.Add(2 * time.Second), Task: "build", Error: "script failed with exit code 2"},
+			{Type: events.RunFinished, Time: start.Add(3 * time.Second), Error: "script failed with exit code 2"},
+		} {
+			c.Handle(event)
+		}
+
+		run := FromReport(c.Run(), "0123456789abcdef")
+
+		assert.Equal(t, "20201001-120000.000-abcdef", run.ID)
+		assert.Equal(t, "0123456789abcdef", run.Commit)
+		assert.Equal(t, "failed", run.Status)
+		assert.Equal(t, 3*time.Second, run.Duration())
+		require.Len(t, run.Tasks, 3)
+
+		build, found := run.Task("build")
+
+		require.True(t, found)
+		assert.Equal(t, "f2", build.Fingerprint)
+		assert.Equal(t, "failed", build.Status)
+		assert.Equal(t, 2*time.Second, build.Duration)
+		assert.Equal(t, 2, *build.ExitCode)
+		assert.Len(t, build.Phases, 2)
+
+		lint, _ := run.Task("lint")
+
+		assert.Equal(t, Task{Name: "lint", Status: "skipped", Reason: "cached", Fingerprint: "f1"}, lint)
+
+		deploy, _ := run.Task("deploy")
+
+		assert.Equal(t, "not run", deploy.Status)
+	})
+}
+
+func TestSameCommit(t *testing.T) {
+	t.Run("Should require the same commit on clean working trees", func(t *testing.T) {
+		run := Run{Commit: "abc"}
+
+		assert.True(t, run.SameCommit("abc", false))
+		assert.False(t, run.SameCommit("def", false))
+		assert.False(t, run.SameCommit("abc", true))
+		assert.False(t, Run{Commit: "abc", Dirty: true}.SameCommit("abc", false))
+		assert.False(t, Run{}.SameCommit("", false))
+	})
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-history")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewStore(dir)
+
+	t.Run("Should return no last run when nothing was recorded", func(t *testing.T) {
+		run, err := store.Last()
+
+		assert.Nil(t, err)
+		assert.Nil(t, run)
+	})
+
+	for _, id := range []string{"20201001-120000.000-aaaaaa", "20201002-120000.000-bbbbbb", "20201002-130000.000-cccccc"} {
+		require.Nil(t, store.Save(Run{ID: id, Target: "deploy", Tasks: []Task{{Name: "build", Duration: time.Second}}}))
+	}
+
+	t.Run("Should list runs, the most recent first", func(t *testing.T) {
+		runs, err := store.List()
+
+		assert.Nil(t, err)
+		require.Len(t, runs, 3)
+		assert.Equal(t, "20201002-130000.000-cccccc", runs[0].ID)
+		assert.Equal(t, "20201001-120000.000-aaaaaa", runs[2].ID)
+		assert.Equal(t, time.Second, runs[2].Tasks[0].Duration)
+
+		last, err := store.Last()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "20201002-130000.000-cccccc", last.ID)
+	})
+
+	t.Run("Should get runs by ID prefix", func(t *testing.T) {
+		run, err := store.Get("20201001")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "20201001-120000.000-aaaaaa", run.ID)
+
+		_, err = store.Get("20201002")
+
+		assert.EqualError(t, err, "run 20201002 is ambiguous, it matches 2 runs")
+
+		_, err = store.Get("2019")
+
+		assert.EqualError(t, err, "run 2019 not found")
+	})
+
+	t.Run("Should remove all but the most recent runs", func(t *testing.T) {
+		require.Nil(t, store.Prune(2))
+
+		runs, err := store.List()
+
+		assert.Nil(t, err)
+		assert.Len(t, runs, 2)
+		assert.Equal(t, "20201002-120000.000-bbbbbb", runs[1].ID)
+	})
+}
@@ -2,22 +2,39 @@ package main
 
 import (
 	"github.com/alexflint/go-arg"
+	"github.com/docker/docker/pkg/reexec"
 	"github.com/kinematic-ci/cogs/cli"
-	"github.com/kinematic-ci/cogs/cogsfile"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 )
 
 func main() {
 	type arguments struct {
-		Run   *cli.RunArgs   `arg:"subcommand:run" help:"Run a target"`
-		Tasks *cli.TasksArgs `arg:"subcommand:tasks" help:"Show all available targets"`
+		Run     *cli.RunArgs     `arg:"subcommand:run" help:"Run a target"`
+		Tasks   *cli.TasksArgs   `arg:"subcommand:tasks" help:"Show all available targets"`
+		Shell   *cli.ShellArgs   `arg:"subcommand:shell" help:"Open an interactive shell in a task's environment"`
+		Cache   *cli.CacheArgs   `arg:"subcommand:cache" help:"Inspect and clean the task output cache"`
+		Watch   *cli.WatchArgs   `arg:"subcommand:watch" help:"Run a target again whenever files change"`
+		History *cli.HistoryArgs `arg:"subcommand:history" help:"Show recent runs and how long their tasks took"`
+	}
+
+	// Helper processes such as the shell sandbox re-execute the cogs binary.
+	if reexec.Init() {
+		return
 	}
 
 	log.SetPrefix("[⚙️ ] ")
 
 	args := arguments{}
 
+	// A task may be named in place of a subcommand.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") && !isSubcommand(args, os.Args[1]) {
+		fallbackToRun()
+		return
+	}
+
 	arg.MustParse(&args)
 
 	switch {
@@ -25,22 +42,60 @@ func main() {
 		cli.Run(args.Run)
 	case args.Tasks != nil:
 		cli.Tasks(args.Tasks)
+	case args.Shell != nil:
+		cli.Shell(args.Shell)
+	case args.Cache != nil:
+		cli.Cache(args.Cache)
+	case args.Watch != nil:
+		cli.Watch(args.Watch)
+	case args.History != nil:
+		cli.History(args.History)
 	default:
 		fallbackToRun()
 	}
 }
 
+// fallbackToRun runs a task when no subcommand is given. The arguments are
+// parsed as those of run, so the defaults of both are the same.
 func fallbackToRun() {
-	var target string
-	switch {
-	case len(os.Args) == 1:
-		target = ""
-	case len(os.Args) >= 2:
-		target = os.Args[1]
+	args, err := fallbackArgs(os.Args[1:])
+
+	if err != nil {
+		log.Fatalln("Invalid arguments", err)
+	}
+
+	cli.Run(args)
+}
 
+// isSubcommand reports whether name is one of the subcommands declared by
+// the fields of args.
+func isSubcommand(args interface{}, name string) bool {
+	t := reflect.TypeOf(args)
+
+	for i := 0; i < t.NumField(); i++ {
+		for _, option := range strings.Split(t.Field(i).Tag.Get("arg"), ",") {
+			if option == "subcommand:"+name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fallbackArgs(args []string) (*cli.RunArgs, error) {
+	runArgs := &cli.RunArgs{}
+	parser, err := arg.NewParser(arg.Config{}, runArgs)
+
+	if err != nil {
+		return nil, err
 	}
-	cli.Run(&cli.RunArgs{
-		Target: target,
-		File:   cogsfile.DefaultFileName,
-	})
+
+	err = parser.Parse(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return runArgs, nil
 }
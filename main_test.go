@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFallbackArgs(t *testing.T) {
+	t.Run("Should use the defaults of run without a target", func(t *testing.T) {
+		args, err := fallbackArgs([]string{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", args.Target)
+		assert.Equal(t, cogsfile.DefaultFileName, args.File)
+		assert.Equal(t, "interleaved", args.Output)
+	})
+
+	t.Run("Should use the defaults of run with a target", func(t *testing.T) {
+		args, err := fallbackArgs([]string{"build"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "build", args.Target)
+		assert.Equal(t, cogsfile.DefaultFileName, args.File)
+		assert.Equal(t, "interleaved", args.Output)
+	})
+}
+
+func TestIsSubcommand(t *testing.T) {
+	args := struct {
+		Run   *struct{} `arg:"subcommand:run" help:"Run a target"`
+		Tasks *struct{} `arg:"subcommand:tasks"`
+	}{}
+
+	t.Run("Should find declared subcommands", func(t *testing.T) {
+		assert.True(t, isSubcommand(args, "run"))
+		assert.True(t, isSubcommand(args, "tasks"))
+	})
+
+	t.Run("Should not take a task name for a subcommand", func(t *testing.T) {
+		assert.False(t, isSubcommand(args, "build"))
+		assert.False(t, isSubcommand(args, "ru"))
+	})
+}
@@ -0,0 +1,215 @@
+package report
+
+import (
+	"github.com/kinematic-ci/cogs/events"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	Passed  Status = "passed"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+	NotRun  Status = "not run"
+)
+
+// Run is the outcome of a run, as reported by its events.
+type Run struct {
+	ID       string
+	Target   string
+	Started  time.Time
+	Finished time.Time
+	Error    string
+	Tasks    []*Task
+}
+
+func (r *Run) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// Status is the status of the run as a whole.
+func (r *Run) Status() Status {
+	if r.Error != "" {
+		return Failed
+	}
+
+	return Passed
+}
+
+type Task struct {
+	Name        string
+	Executor    string
+	Fingerprint string
+	Started     time.Time
+	Finished    time.Time
+	Skipped     bool
+	Reason      string
+	Error       string
+	Steps       []*Step
+	Phases      []*Phase
+}
+
+func (t *Task) Duration() time.Duration {
+	return t.Finished.Sub(t.Started)
+}
+
+func (t *Task) Status() Status {
+	switch {
+	case t.Skipped:
+		return Skipped
+	case t.Started.IsZero():
+		return NotRun
+	case t.Error != "":
+		return Failed
+	default:
+		return Passed
+	}
+}
+
+// Phase returns the phase with the given name, or nil if it didn't run.
+func (t *Task) Phase(name string) *Phase {
+	for _, phase := range t.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+
+	return nil
+}
+
+// Step returns the executor step with the given name, or nil if it wasn't
+// taken.
+func (t *Task) Step(name string) *Step {
+	for _, step := range t.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+
+	return nil
+}
+
+// Step is something the executor of a task did to prepare its environment,
+// such as pulling an image.
+type Step struct {
+	Name     string
+	Started  time.Time
+	Finished time.Time
+	Error    string
+}
+
+func (s *Step) Duration() time.Duration {
+	return s.Finished.Sub(s.Started)
+}
+
+type Phase struct {
+	Name     string
+	Started  time.Time
+	Finished time.Time
+	ExitCode *int
+	Error    string
+	output   strings.Builder
+}
+
+func (p *Phase) Duration() time.Duration {
+	return p.Finished.Sub(p.Started)
+}
+
+func (p *Phase) Failed() bool {
+	return p.Error != "" || (p.ExitCode != nil && *p.ExitCode != 0)
+}
+
+func (p *Phase) Output() string {
+	return p.output.String()
+}
+
+// Collector builds the outcome of a run from its events.
+type Collector struct {
+	mutex sync.Mutex
+	run   Run
+	tasks map[string]*Task
+}
+
+func NewCollector() *Collector {
+	return &Collector{tasks: map[string]*Task{}}
+}
+
+func (c *Collector) Handle(event events.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch event.Type {
+	case events.RunStarted:
+		c.run.ID = event.Run
+		c.run.Target = event.Target
+		c.run.Started = event.Time
+	case events.RunFinished:
+		c.run.Finished = event.Time
+		c.run.Error = event.Error
+	case events.TaskPlanned:
+		c.task(event.Task).Executor = event.Executor
+	case events.TaskStarted:
+		task := c.task(event.Task)
+		task.Started = event.Time
+		task.Fingerprint = event.Fingerprint
+	case events.TaskSkipped:
+		task := c.task(event.Task)
+		task.Skipped = true
+		task.Reason = event.Reason
+		task.Fingerprint = event.Fingerprint
+	case events.TaskFinished:
+		task := c.task(event.Task)
+		task.Finished = event.Time
+		task.Error = event.Error
+
+		if event.Fingerprint != "" {
+			task.Fingerprint = event.Fingerprint
+		}
+	case events.ExecutorStepStarted:
+		task := c.task(event.Task)
+		task.Steps = append(task.Steps, &Step{Name: event.Step, Started: event.Time})
+	case events.ExecutorStepFinished:
+		if step := c.task(event.Task).Step(event.Step); step != nil {
+			step.Finished = event.Time
+			step.Error = event.Error
+		}
+	case events.PhaseStarted:
+		task := c.task(event.Task)
+		task.Phases = append(task.Phases, &Phase{Name: event.Phase, Started: event.Time})
+	case events.PhaseFinished:
+		if phase := c.task(event.Task).Phase(event.Phase); phase != nil {
+			phase.Finished = event.Time
+			phase.ExitCode = event.ExitCode
+			phase.Error = event.Error
+		}
+	case events.Output:
+		if phase := c.task(event.Task).Phase(event.Phase); phase != nil {
+			phase.output.WriteString(event.Data)
+		}
+	}
+}
+
+func (c *Collector) task(name string) *Task {
+	task, found := c.tasks[name]
+
+	if !found {
+		task = &Task{Name: name}
+		c.tasks[name] = task
+		c.run.Tasks = append(c.run.Tasks, task)
+	}
+
+	return task
+}
+
+// Run returns the outcome of the run so far.
+func (c *Collector) Run() *Run {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	run := c.run
+
+	return &run
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the run as JUnit XML. Every task is a test case, and so
+// is every phase of it, holding the output of the phase.
+func WriteJUnit(w io.Writer, run *Run) error {
+	suite := junitSuite{Name: run.Target, Time: seconds(run.Duration())}
+
+	if !run.Started.IsZero() {
+		suite.Timestamp = run.Started.UTC().Format("2006-01-02T15:04:05")
+	}
+
+	for _, task := range run.Tasks {
+		testCase := junitCase{Name: task.Name, ClassName: task.Name, Time: seconds(task.Duration())}
+
+		switch task.Status() {
+		case Failed:
+			testCase.Failure = &junitMessage{Message: task.Error}
+		case Skipped:
+			testCase.Skipped = &junitMessage{Message: task.Reason}
+		case NotRun:
+			testCase.Skipped = &junitMessage{Message: string(NotRun)}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+
+		for _, phase := range task.Phases {
+			phaseCase := junitCase{
+				Name:      phase.Name,
+				ClassName: task.Name,
+				Time:      seconds(phase.Duration()),
+				SystemOut: phase.Output(),
+			}
+
+			if phase.Failed() {
+				phaseCase.Failure = &junitMessage{Message: phaseFailure(phase)}
+			}
+
+			suite.Cases = append(suite.Cases, phaseCase)
+		}
+	}
+
+	for _, testCase := range suite.Cases {
+		suite.Tests++
+
+		if testCase.Failure != nil {
+			suite.Failures++
+		} else if testCase.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+
+	suites := junitSuites{
+		Name:     "cogs",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write report")
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	err = encoder.Encode(suites)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write report")
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+func phaseFailure(phase *Phase) string {
+	if phase.Error != "" {
+		return phase.Error
+	}
+
+	return fmt.Sprintf("exit code %d", *phase.ExitCode)
+}
+
+func seconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
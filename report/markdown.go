@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// markdownOutputLines limits the output shown for a failed task.
+const markdownOutputLines = 50
+
+var statusIcons = map[Status]string{
+	Passed:  "✅",
+	Failed:  "❌",
+	Skipped: "⏭️",
+	NotRun:  "⏸️",
+}
+
+// WriteMarkdown writes a summary of the run suitable for pull request
+// comments: a table of tasks and the end of the output of failed tasks.
+func WriteMarkdown(w io.Writer, run *Run) error {
+	var b strings.Builder
+
+	status := run.Status()
+	fmt.Fprintf(&b, "### %s cogs run `%s` %s in %s\n\n", statusIcons[status], run.Target, status, duration(run.Duration()))
+	fmt.Fprintf(&b, "| Task | Status | Duration | %s | %s | %s |\n", events.BeforeScript, events.Script, events.AfterScript)
+	b.WriteString("|------|--------|----------|---|---|---|\n")
+
+	for _, task := range run.Tasks {
+		taskStatus := string(task.Status())
+
+		if task.Reason != "" {
+			taskStatus += " (" + task.Reason + ")"
+		}
+
+		fmt.Fprintf(&b, "| %s | %s %s | %s | %s | %s | %s |\n",
+			task.Name, statusIcons[task.Status()], taskStatus, taskDuration(task),
+			phaseDuration(task.Phase(events.BeforeScript)),
+			phaseDuration(task.Phase(events.Script)),
+			phaseDuration(task.Phase(events.AfterScript)))
+	}
+
+	for _, task := range run.Tasks {
+		if task.Status() != Failed {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n<details><summary>%s: %s</summary>\n\n```\n", task.Name, task.Error)
+
+		for _, phase := range task.Phases {
+			if phase.Failed() {
+				b.WriteString(lastLines(phase.Output(), markdownOutputLines))
+			}
+		}
+
+		b.WriteString("```\n\n</details>\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write report")
+	}
+
+	return nil
+}
+
+func taskDuration(task *Task) string {
+	if task.Started.IsZero() || task.Finished.IsZero() {
+		return "-"
+	}
+
+	return duration(task.Duration())
+}
+
+func phaseDuration(phase *Phase) string {
+	if phase == nil || phase.Finished.IsZero() {
+		return "-"
+	}
+
+	return duration(phase.Duration())
+}
+
+func duration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func lastLines(output string, n int) string {
+	lines := strings.SplitAfter(strings.TrimRight(output, "\n"), "\n")
+
+	if len(lines) > n {
+		lines = append([]string{"...\n"}, lines[len(lines)-n:]...)
+	}
+
+	// A fence in the output would end the code block early.
+	result := strings.Replace(strings.Join(lines, ""), "```", "'''", -1)
+
+	if result != "" && !strings.HasSuffix(result, "\n") {
+		result += "\n"
+	}
+
+	return result
+}
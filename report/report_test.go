@@ -0,0 +1,147 @@
+package report
+
+import (
+	"bytes"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func collectTestRun() *Run {
+	start := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	c := NewCollector()
+
+	for _, event := range []events.Event{
+		{Type: events.RunStarted, Time: at(0), Target: "deploy", Tasks: []string{"lint", "build", "deploy"}},
+		{Type: events.TaskPlanned, Time: at(0), Task: "lint", Executor: "shell"},
+		{Type: events.TaskPlanned, Time: at(0), Task: "build", Executor: "docker"},
+		{Type: events.TaskPlanned, Time: at(0), Task: "deploy", Executor: "shell"},
+		{Type: events.TaskSkipped, Time: at(10), Task: "lint", Reason: "cached"},
+		{Type: events.TaskStarted, Time: at(10), Task: "build"},
+		{Type: events.ExecutorStepStarted, Time: at(10), Task: "build", Executor: "docker", Step: events.ImagePull},
+		{Type: events.ExecutorStepFinished, Time: at(14), Task: "build", Executor: "docker", Step: events.ImagePull},
+		{Type: events.ExecutorStepStarted, Time: at(14), Task: "build", Executor: "docker", Step: events.ContainerStart},
+		{Type: events.ExecutorStepFinished, Time: at(18), Task: "build", Executor: "docker", Step: events.ContainerStart},
+		{Type: events.PhaseStarted, Time: at(20), Task: "build", Phase: events.Script},
+		{Type: events.Output, Time: at(30), Task: "build", Phase: events.Script, Data: "+ go build\n"},
+		{Type: events.Output, Time: at(40), Task: "build", Phase: events.Script, Data: "main.go:1: syntax error\n"},
+		events.Event{Type: events.PhaseFinished, Time: at(1520), Task: "build", Phase: events.Script}.WithExitCode(2),
+		{Type: events.TaskFinished, Time: at(1530), Task: "build", Error: "script failed with exit code 2"},
+		{Type: events.RunFinished, Time: at(1540), Target: "deploy", Error: "error executing task: script failed with exit code 2"},
+	} {
+		c.Handle(event)
+	}
+
+	return c.Run()
+}
+
+func TestCollector(t *testing.T) {
+	t.Run("Should collect task results", func(t *testing.T) {
+		run := collectTestRun()
+
+		assert.Equal(t, Failed, run.Status())
+		assert.Equal(t, 1540*time.Millisecond, run.Duration())
+		assert.Len(t, run.Tasks, 3)
+		assert.Equal(t, Skipped, run.Tasks[0].Status())
+		assert.Equal(t, Failed, run.Tasks[1].Status())
+		assert.Equal(t, NotRun, run.Tasks[2].Status())
+		assert.Equal(t, "docker", run.Tasks[1].Executor)
+
+		script := run.Tasks[1].Phase(events.Script)
+
+		require.NotNil(t, script)
+		assert.True(t, script.Failed())
+		assert.Equal(t, 1500*time.Millisecond, script.Duration())
+		assert.Equal(t, "+ go build\nmain.go:1: syntax error\n", script.Output())
+
+		pull := run.Tasks[1].Step(events.ImagePull)
+
+		require.NotNil(t, pull)
+		assert.Equal(t, 4*time.Millisecond, pull.Duration())
+	})
+
+	t.Run("Should keep the fingerprint a task has once it ran", func(t *testing.T) {
+		c := NewCollector()
+
+		c.Handle(events.Event{Type: events.TaskStarted, Task: "build", Fingerprint: "before"})
+		c.Handle(events.Event{Type: events.TaskFinished, Task: "build", Fingerprint: "after"})
+		c.Handle(events.Event{Type: events.TaskStarted, Task: "test", Fingerprint: "unchanged"})
+		c.Handle(events.Event{Type: events.TaskFinished, Task: "test"})
+
+		run := c.Run()
+
+		assert.Equal(t, "after", run.Tasks[0].Fingerprint)
+		assert.Equal(t, "unchanged", run.Tasks[1].Fingerprint)
+	})
+}
+
+func TestWriteJUnit(t *testing.T) {
+	t.Run("Should write tasks and phases as test cases", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteJUnit(&output, collectTestRun())
+
+		assert.Nil(t, err)
+		assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="cogs" tests="4" failures="2" skipped="2" time="1.540">
+  <testsuite name="deploy" tests="4" failures="2" skipped="2" time="1.540" timestamp="2020-10-01T12:00:00">
+    <testcase name="lint" classname="lint" time="0.000">
+      <skipped message="cached"></skipped>
+    </testcase>
+    <testcase name="build" classname="build" time="1.520">
+      <failure message="script failed with exit code 2"></failure>
+    </testcase>
+    <testcase name="script" classname="build" time="1.500">
+      <failure message="exit code 2"></failure>
+      <system-out>+ go build&#xA;main.go:1: syntax error&#xA;</system-out>
+    </testcase>
+    <testcase name="deploy" classname="deploy" time="0.000">
+      <skipped message="not run"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, output.String())
+	})
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	t.Run("Should summarize tasks and show output of failures", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteMarkdown(&output, collectTestRun())
+
+		assert.Nil(t, err)
+		assert.Equal(t, "### ❌ cogs run `deploy` failed in 1.5s\n\n"+
+			"| Task | Status | Duration | before_script | script | after_script |\n"+
+			"|------|--------|----------|---|---|---|\n"+
+			"| lint | ⏭️ skipped (cached) | - | - | - | - |\n"+
+			"| build | ❌ failed | 1.5s | - | 1.5s | - |\n"+
+			"| deploy | ⏸️ not run | - | - | - | - |\n"+
+			"\n<details><summary>build: script failed with exit code 2</summary>\n\n"+
+			"```\n+ go build\nmain.go:1: syntax error\n```\n\n</details>\n", output.String())
+	})
+}
+
+func TestWriteTimings(t *testing.T) {
+	t.Run("Should write durations of tasks, phases and the critical path", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteTimings(&output, collectTestRun(), []string{"lint", "build", "deploy"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, `TASK    STATUS   IMAGE PULL  CONTAINER START  BEFORE_SCRIPT  SCRIPT  AFTER_SCRIPT  TOTAL
+lint    skipped  -           -                -              -       -             -
+build   failed   4ms         4ms              -              1.5s    -             1.5s
+deploy  not run  -           -                -              -       -             -
+
+Total: 1.5s
+Critical path: lint → build → deploy (1.5s)
+`, output.String())
+	})
+}
@@ -0,0 +1,70 @@
+package report
+
+import (
+	"fmt"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTimings writes a table of how long each task took, split into the
+// steps its executor took and its phases, followed by the duration of the run
+// and its critical path.
+func WriteTimings(w io.Writer, run *Run, criticalPath []string) error {
+	var b strings.Builder
+	table := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "TASK\tSTATUS\tIMAGE PULL\tCONTAINER START\tBEFORE_SCRIPT\tSCRIPT\tAFTER_SCRIPT\tTOTAL")
+
+	for _, task := range run.Tasks {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			task.Name, task.Status(),
+			stepDuration(task.Step(events.ImagePull)),
+			stepDuration(task.Step(events.ContainerStart)),
+			phaseDuration(task.Phase(events.BeforeScript)),
+			phaseDuration(task.Phase(events.Script)),
+			phaseDuration(task.Phase(events.AfterScript)),
+			taskDuration(task))
+	}
+
+	err := table.Flush()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write timings")
+	}
+
+	fmt.Fprintf(&b, "\nTotal: %s\n", duration(run.Duration()))
+
+	if len(criticalPath) > 0 {
+		var total time.Duration
+
+		for _, name := range criticalPath {
+			for _, task := range run.Tasks {
+				if task.Name == name && !task.Started.IsZero() && !task.Finished.IsZero() {
+					total += task.Duration()
+				}
+			}
+		}
+
+		fmt.Fprintf(&b, "Critical path: %s (%s)\n", strings.Join(criticalPath, " → "), duration(total))
+	}
+
+	_, err = io.WriteString(w, b.String())
+
+	if err != nil {
+		return errors.Wrap(err, "unable to write timings")
+	}
+
+	return nil
+}
+
+func stepDuration(step *Step) string {
+	if step == nil || step.Finished.IsZero() {
+		return "-"
+	}
+
+	return duration(step.Duration())
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/kinematic-ci/cogs/list"
+	"github.com/kinematic-ci/cogs/utils"
+)
+
+// Affected returns the tasks needed by the entrypoint that have to run again
+// after the given files changed, in execution order. A task is affected when
+// a changed file matches its sources, when it declares no sources and any
+// file changed, when it isn't in completed, or when one of its dependencies
+// is affected.
+func Affected(tasks []cogsfile.Task, entrypoint string, changed []string, completed map[string]bool) (*list.TaskList, error) {
+	order, err := ExecutionOrder(tasks, entrypoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	affected := set{}
+	result := list.NewTaskList()
+
+	for _, task := range order.Values() {
+		if isAffected(task, changed, completed, affected) {
+			affected.add(task.Name)
+			result.Add(task)
+		}
+	}
+
+	return result, nil
+}
+
+func isAffected(task cogsfile.Task, changed []string, completed map[string]bool, affected set) bool {
+	if !completed[task.Name] {
+		return true
+	}
+
+	for _, dependency := range task.DependsOn {
+		if affected[dependency] {
+			return true
+		}
+	}
+
+	if len(task.Sources) == 0 {
+		return len(changed) > 0
+	}
+
+	for _, file := range changed {
+		if utils.Match(task.Sources, file) {
+			return true
+		}
+	}
+
+	return false
+}
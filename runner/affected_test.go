@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAffected(t *testing.T) {
+	tasks := []cogsfile.Task{
+		{Name: "deploy", DependsOn: []string{"build", "docs"}},
+		{Name: "build", DependsOn: []string{"generate"}, Sources: []string{"**/*.go"}},
+		{Name: "generate", Sources: []string{"api/*.proto"}},
+		{Name: "docs", Sources: []string{"docs"}},
+	}
+	completed := map[string]bool{"generate": true, "build": true, "docs": true, "deploy": true}
+
+	names := func(tasks []cogsfile.Task) []string {
+		result := []string{}
+
+		for _, task := range tasks {
+			result = append(result, task.Name)
+		}
+
+		return result
+	}
+
+	t.Run("Should select tasks whose sources changed and their dependents", func(t *testing.T) {
+		affected, err := Affected(tasks, "deploy", []string{"cli/run.go"}, completed)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"build", "deploy"}, names(affected.Values()))
+
+		affected, err = Affected(tasks, "deploy", []string{"api/service.proto"}, completed)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"generate", "build", "deploy"}, names(affected.Values()))
+	})
+
+	t.Run("Should only consider tasks needed by the entrypoint", func(t *testing.T) {
+		affected, err := Affected(tasks, "build", []string{"docs/index.md"}, completed)
+
+		assert.Nil(t, err)
+		assert.Empty(t, affected.Values())
+	})
+
+	t.Run("Should select tasks which did not complete", func(t *testing.T) {
+		affected, err := Affected(tasks, "deploy", []string{"docs/index.md"}, map[string]bool{"generate": true, "build": true})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"docs", "deploy"}, names(affected.Values()))
+	})
+
+	t.Run("Should return error if entrypoint is not found", func(t *testing.T) {
+		_, err := Affected(tasks, "nonexistent", nil, completed)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"time"
+)
+
+// CriticalPath returns the chain of tasks leading to the entrypoint whose
+// durations add up to the most, which bounds how fast the entrypoint can
+// complete however its dependencies are scheduled. Tasks without a duration
+// count as taking no time. The path starts with a task without dependencies
+// and ends with the entrypoint.
+func CriticalPath(tasks []cogsfile.Task, entrypoint string, durations map[string]time.Duration) ([]string, time.Duration, error) {
+	order, err := ExecutionOrder(tasks, entrypoint)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Dependencies come first in execution order, so the longest path to each
+	// of them is known by the time a task is reached.
+	longest := map[string]time.Duration{}
+	previous := map[string]string{}
+
+	for _, task := range order.Values() {
+		var via string
+
+		for _, dependency := range task.DependsOn {
+			if via == "" || longest[dependency] > longest[via] {
+				via = dependency
+			}
+		}
+
+		longest[task.Name] = longest[via] + durations[task.Name]
+		previous[task.Name] = via
+	}
+
+	var path []string
+
+	for name := entrypoint; name != ""; name = previous[name] {
+		path = append([]string{name}, path...)
+	}
+
+	return path, longest[entrypoint], nil
+}
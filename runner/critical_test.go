@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCriticalPath(t *testing.T) {
+	tasks := []cogsfile.Task{
+		{Name: "deploy", DependsOn: []string{"test", "image"}},
+		{Name: "test", DependsOn: []string{"build"}},
+		{Name: "image", DependsOn: []string{"build", "assets"}},
+		{Name: "build", DependsOn: []string{"generate"}},
+		{Name: "generate"},
+		{Name: "assets"},
+	}
+
+	t.Run("Should return the longest chain of dependencies", func(t *testing.T) {
+		path, duration, err := CriticalPath(tasks, "deploy", map[string]time.Duration{
+			"generate": 1 * time.Second,
+			"build":    10 * time.Second,
+			"assets":   30 * time.Second,
+			"test":     25 * time.Second,
+			"image":    5 * time.Second,
+			"deploy":   2 * time.Second,
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"generate", "build", "test", "deploy"}, path)
+		assert.Equal(t, 38*time.Second, duration)
+	})
+
+	t.Run("Should count tasks without duration as taking no time", func(t *testing.T) {
+		path, duration, err := CriticalPath(tasks, "image", map[string]time.Duration{
+			"assets": 3 * time.Second,
+			"image":  time.Second,
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"assets", "image"}, path)
+		assert.Equal(t, 4*time.Second, duration)
+	})
+
+	t.Run("Should return error if entrypoint is not found", func(t *testing.T) {
+		_, _, err := CriticalPath(tasks, "nonexistent", nil)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bufio"
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var outputKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// ParseOutputs reads the key=value lines a task wrote to its output file.
+// Blank lines and lines starting with # are ignored, later values win.
+func ParseOutputs(r io.Reader) (map[string]string, error) {
+	outputs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(parts[0])
+
+		if len(parts) != 2 || !outputKeyPattern.MatchString(key) {
+			return nil, errors.Errorf("line %d: expected key=value, got %s", line, text)
+		}
+
+		outputs[key] = parts[1]
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read outputs")
+	}
+
+	return outputs, nil
+}
+
+// ResolveOutputs returns a copy of the task with every output reference
+// replaced by the value published by the referenced task.
+func ResolveOutputs(task cogsfile.Task, outputs map[string]map[string]string) (cogsfile.Task, error) {
+	var missing error
+
+	resolve := func(value string) string {
+		return cogsfile.OutputReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+			match := cogsfile.OutputReferencePattern.FindStringSubmatch(reference)
+			output, found := outputs[match[1]][match[2]]
+
+			if !found && missing == nil {
+				missing = errors.Errorf("task %s has no output %s", match[1], match[2])
+			}
+
+			return output
+		})
+	}
+
+	resolveScript := func(script cogsfile.Script) cogsfile.Script {
+		if script == nil {
+			return nil
+		}
+
+		resolved := make(cogsfile.Script, len(script))
+
+		for i, command := range script {
+			resolved[i] = cogsfile.Command{Line: resolve(command.Line)}
+
+			if command.Argv != nil {
+				resolved[i].Argv = make([]string, len(command.Argv))
+
+				for j, word := range command.Argv {
+					resolved[i].Argv[j] = resolve(word)
+				}
+			}
+		}
+
+		return resolved
+	}
+
+	task.Image = resolve(task.Image)
+	task.BeforeScript = resolveScript(task.BeforeScript)
+	task.Script = resolveScript(task.Script)
+	task.AfterScript = resolveScript(task.AfterScript)
+
+	if task.EnvVars != nil {
+		env := make(map[string]string, len(task.EnvVars))
+
+		for name, value := range task.EnvVars {
+			env[name] = resolve(value)
+		}
+
+		task.EnvVars = env
+	}
+
+	if missing != nil {
+		return cogsfile.Task{}, errors.Wrapf(missing, "unable to resolve outputs for task %s", task.Name)
+	}
+
+	return task, nil
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	t.Run("Should parse key value lines", func(t *testing.T) {
+		outputs, err := ParseOutputs(strings.NewReader("# version\ntag=v1.2.3\n\nurl=http://host/?a=b\ntag=v1.2.4\n"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"tag": "v1.2.4", "url": "http://host/?a=b"}, outputs)
+	})
+
+	t.Run("Should return error for invalid lines", func(t *testing.T) {
+		_, err := ParseOutputs(strings.NewReader("tag=v1\nversion\n"))
+
+		assert.EqualError(t, err, "line 2: expected key=value, got version")
+	})
+}
+
+func TestResolveOutputs(t *testing.T) {
+	outputs := map[string]map[string]string{"version": {"tag": "v1"}}
+
+	t.Run("Should replace references", func(t *testing.T) {
+		task := cogsfile.Task{
+			Name:      "publish",
+			Image:     "app:${{ tasks.version.outputs.tag }}",
+			EnvVars:   map[string]string{"TAG": "${{tasks.version.outputs.tag}}"},
+			Script:    cogsfile.Script{{Argv: []string{"docker", "push", "app:${{ tasks.version.outputs.tag }}"}}},
+			DependsOn: []string{"version"},
+		}
+
+		resolved, err := ResolveOutputs(task, outputs)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "app:v1", resolved.Image)
+		assert.Equal(t, map[string]string{"TAG": "v1"}, resolved.EnvVars)
+		assert.Equal(t, cogsfile.Script{{Argv: []string{"docker", "push", "app:v1"}}}, resolved.Script)
+		assert.Equal(t, "app:${{ tasks.version.outputs.tag }}", task.Script[0].Argv[2])
+	})
+
+	t.Run("Should return error for missing outputs", func(t *testing.T) {
+		task := cogsfile.Task{Name: "publish", Script: cogsfile.Script{{Line: "echo ${{ tasks.version.outputs.digest }}"}}}
+
+		_, err := ResolveOutputs(task, outputs)
+
+		assert.EqualError(t, err, "unable to resolve outputs for task publish: task version has no output digest")
+	})
+}
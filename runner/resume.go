@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+)
+
+// Resume decides which tasks a run resuming a previous one can skip.
+type Resume struct {
+	succeeded  map[string]string
+	sameCommit bool
+	ran        set
+}
+
+// NewResume resumes a run in which the given tasks succeeded, mapped to their
+// fingerprints. sameCommit tells whether the previous run was on the commit
+// checked out now.
+func NewResume(succeeded map[string]string, sameCommit bool) *Resume {
+	return &Resume{succeeded: succeeded, sameCommit: sameCommit, ran: set{}}
+}
+
+// Skip reports whether a task can be skipped: it succeeded in the previous
+// run with the same fingerprint, and none of its dependencies runs again. The
+// fingerprint of a task without sources covers no files, so such a task is
+// only skipped on the same commit.
+func (r *Resume) Skip(task cogsfile.Task, fingerprint string) bool {
+	previous, found := r.succeeded[task.Name]
+
+	if !found || fingerprint == "" || previous != fingerprint {
+		return false
+	}
+
+	if len(task.Sources) == 0 && !r.sameCommit {
+		return false
+	}
+
+	for _, dependency := range task.DependsOn {
+		if r.ran[dependency] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Ran records that a task runs again, so that the tasks depending on it run
+// again too.
+func (r *Resume) Ran(task string) {
+	r.ran.add(task)
+}
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"github.com/kinematic-ci/cogs/cogsfile"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	generate := cogsfile.Task{Name: "generate"}
+	build := cogsfile.Task{Name: "build", DependsOn: []string{"generate"}, Sources: []string{"**/*.go"}}
+	test := cogsfile.Task{Name: "test", DependsOn: []string{"build"}, Sources: []string{"**/*.go"}}
+	succeeded := map[string]string{"generate": "g1", "build": "b1"}
+
+	t.Run("Should skip tasks which succeeded with the same fingerprint", func(t *testing.T) {
+		r := NewResume(succeeded, true)
+
+		assert.True(t, r.Skip(generate, "g1"))
+		assert.True(t, r.Skip(build, "b1"))
+		assert.False(t, r.Skip(test, "t1"))
+	})
+
+	t.Run("Should run tasks whose fingerprint changed", func(t *testing.T) {
+		r := NewResume(succeeded, true)
+
+		assert.False(t, r.Skip(build, "b2"))
+		assert.False(t, r.Skip(build, ""))
+	})
+
+	t.Run("Should run tasks whose dependencies run again", func(t *testing.T) {
+		r := NewResume(succeeded, true)
+		r.Ran("generate")
+
+		assert.False(t, r.Skip(build, "b1"))
+	})
+
+	t.Run("Should run tasks without sources on another commit", func(t *testing.T) {
+		r := NewResume(succeeded, false)
+
+		assert.False(t, r.Skip(generate, "g1"))
+		assert.True(t, r.Skip(cogsfile.Task{Name: "build", Sources: []string{"**/*.go"}}, "b1"))
+	})
+}
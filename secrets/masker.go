@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// Mask replaces secret values in output.
+const Mask = "***"
+
+// Masker replaces secret values written to it with ***. Output which could be
+// the start of a secret is held back until the next write shows whether it
+// is, so secrets split across writes are masked too.
+type Masker struct {
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func NewMasker(w io.Writer, values []string) *Masker {
+	m := &Masker{w: w}
+
+	for _, value := range values {
+		if value != "" {
+			m.secrets = append(m.secrets, []byte(value))
+		}
+	}
+
+	// Longer secrets win over secrets they start with.
+	sort.Slice(m.secrets, func(i, j int) bool {
+		return len(m.secrets[i]) > len(m.secrets[j])
+	})
+
+	return m
+}
+
+func (m *Masker) Write(p []byte) (int, error) {
+	if len(m.secrets) == 0 {
+		return m.w.Write(p)
+	}
+
+	m.pending = append(m.pending, p...)
+	masked, rest := m.mask(m.pending, false)
+	m.pending = append(m.pending[:0], rest...)
+
+	if len(masked) > 0 {
+		_, err := m.w.Write(masked)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes output held back because it could have been the start of a
+// secret.
+func (m *Masker) Flush() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+
+	masked, _ := m.mask(m.pending, true)
+	m.pending = m.pending[:0]
+
+	_, err := m.w.Write(masked)
+
+	return err
+}
+
+// mask returns the masked output and, unless final is set, the end of the
+// input which may be the start of a secret.
+func (m *Masker) mask(input []byte, final bool) ([]byte, []byte) {
+	var out bytes.Buffer
+
+	for i := 0; i < len(input); {
+		secret, partial := m.match(input[i:])
+
+		switch {
+		case secret > 0:
+			out.WriteString(Mask)
+			i += secret
+		case partial && !final:
+			return out.Bytes(), input[i:]
+		default:
+			out.WriteByte(input[i])
+			i++
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// match returns the length of the secret input starts with, or whether input
+// is the start of a secret.
+func (m *Masker) match(input []byte) (int, bool) {
+	partial := false
+
+	for _, secret := range m.secrets {
+		if bytes.HasPrefix(input, secret) {
+			return len(secret), false
+		}
+
+		if len(input) < len(secret) && bytes.HasPrefix(secret, input) {
+			partial = true
+		}
+	}
+
+	return 0, partial
+}
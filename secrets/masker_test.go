@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMasker(t *testing.T) {
+	t.Run("Should mask secrets", func(t *testing.T) {
+		var output bytes.Buffer
+		m := NewMasker(&output, []string{"hunter2", "", "s3cr3t"})
+
+		_, err := m.Write([]byte("+ login -p hunter2\nuser s3cr3t and hunter2\n"))
+
+		assert.Nil(t, err)
+		assert.Nil(t, m.Flush())
+		assert.Equal(t, "+ login -p ***\nuser *** and ***\n", output.String())
+	})
+
+	t.Run("Should mask secrets split across writes", func(t *testing.T) {
+		var output bytes.Buffer
+		m := NewMasker(&output, []string{"hunter2"})
+
+		for _, chunk := range []string{"token hun", "t", "er2 done, hunt", "ing"} {
+			_, err := m.Write([]byte(chunk))
+			assert.Nil(t, err)
+		}
+
+		assert.Nil(t, m.Flush())
+		assert.Equal(t, "token *** done, hunting", output.String())
+	})
+
+	t.Run("Should write held back output on flush", func(t *testing.T) {
+		var output bytes.Buffer
+		m := NewMasker(&output, []string{"hunter2"})
+
+		_, err := m.Write([]byte("ends with hunt"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "ends with ", output.String())
+		assert.Nil(t, m.Flush())
+		assert.Equal(t, "ends with hunt", output.String())
+	})
+
+	t.Run("Should prefer longer secrets", func(t *testing.T) {
+		var output bytes.Buffer
+		m := NewMasker(&output, []string{"abc", "abcdef"})
+
+		_, err := m.Write([]byte("abcdef abc"))
+
+		assert.Nil(t, err)
+		assert.Nil(t, m.Flush())
+		assert.Equal(t, "*** ***", output.String())
+	})
+
+	t.Run("Should mask secrets spanning lines", func(t *testing.T) {
+		var output bytes.Buffer
+		m := NewMasker(&output, []string{"-----BEGIN KEY-----\nMIIEv\n-----END KEY-----"})
+
+		for _, chunk := range []string{"key: -----BEGIN KEY-----\n", "MIIEv\n", "-----END KEY-----\nMIIEv\n"} {
+			_, err := m.Write([]byte(chunk))
+			assert.Nil(t, err)
+		}
+
+		assert.Nil(t, m.Flush())
+		assert.Equal(t, "key: ***\nMIIEv\n", output.String())
+	})
+}
@@ -0,0 +1,185 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	tracesPath       = "/v1/traces"
+	spanKindInternal = 1
+	statusOK         = 1
+	statusError      = 2
+)
+
+// The OTLP/HTTP JSON encoding of an ExportTraceServiceRequest, reduced to the
+// fields cogs sets.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriteOTLP writes spans in the OTLP JSON encoding, as accepted by OTLP/HTTP
+// collectors.
+func WriteOTLP(w io.Writer, spans []Span) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(newRequest(spans))
+}
+
+// ExportOTLP sends spans to an OTLP/HTTP collector. The endpoint is the base
+// URL of the collector, such as http://localhost:4318, or the full URL of
+// its traces endpoint.
+func ExportOTLP(ctx context.Context, endpoint string, spans []Span) error {
+	var body bytes.Buffer
+
+	err := json.NewEncoder(&body).Encode(newRequest(spans))
+
+	if err != nil {
+		return errors.Wrap(err, "unable to encode trace")
+	}
+
+	url := strings.TrimSuffix(endpoint, "/")
+
+	if !strings.HasSuffix(url, tracesPath) {
+		url += tracesPath
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+
+	if err != nil {
+		return errors.Wrap(err, "invalid trace endpoint")
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to export trace to %s", url)
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode/100 != 2 {
+		return errors.Errorf("unable to export trace to %s: %s", url, response.Status)
+	}
+
+	return nil
+}
+
+func newRequest(spans []Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+
+	for _, span := range spans {
+		status := otlpStatus{Code: statusOK}
+
+		if span.Error != "" {
+			status = otlpStatus{Code: statusError, Message: span.Error}
+		}
+
+		encoded = append(encoded, otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attributes),
+			Status:            status,
+		})
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": "cogs"})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "cogs"}, Spans: encoded}},
+	}}}
+}
+
+func attributes(values map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	encoded := make([]otlpAttribute, 0, len(keys))
+
+	for _, key := range keys {
+		var value otlpValue
+
+		switch v := values[key].(type) {
+		case bool:
+			value.BoolValue = &v
+		case int:
+			i := strconv.Itoa(v)
+			value.IntValue = &i
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+
+		encoded = append(encoded, otlpAttribute{Key: key, Value: value})
+	}
+
+	return encoded
+}
@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/kinematic-ci/cogs/events"
+	"sync"
+	"time"
+)
+
+// Span is a timed operation of a run. Attribute values are strings, ints or
+// bools.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string
+}
+
+// Tracer builds the trace of a run from its events. The run is the root span,
+// with a span per task below it. The phases of a task and the steps its
+// executor takes, such as pulling the image and starting the container, are
+// spans below that of the task.
+type Tracer struct {
+	mutex   sync.Mutex
+	traceID string
+	root    *Span
+	spans   []*Span
+	tasks   map[string]*Span
+	open    map[string]*Span
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{
+		traceID: newID(16),
+		tasks:   map[string]*Span{},
+		open:    map[string]*Span{},
+	}
+}
+
+func (t *Tracer) Handle(event events.Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	switch event.Type {
+	case events.RunStarted:
+		t.root = t.start(nil, "run "+event.Target, event.Time)
+		t.root.Attributes["cogs.run.id"] = event.Run
+		t.root.Attributes["cogs.target"] = event.Target
+	case events.RunFinished:
+		for key, span := range t.open {
+			span.End = event.Time
+			delete(t.open, key)
+		}
+
+		if t.root != nil {
+			t.root.End = event.Time
+			t.root.Error = event.Error
+		}
+	case events.TaskStarted:
+		span := t.start(t.root, event.Task, event.Time)
+		span.Attributes["cogs.task"] = event.Task
+		t.tasks[event.Task] = span
+		t.open[event.Task] = span
+	case events.TaskSkipped:
+		span := t.start(t.root, event.Task, event.Time)
+		span.End = event.Time
+		span.Attributes["cogs.task"] = event.Task
+		span.Attributes["cogs.skipped"] = true
+		span.Attributes["cogs.skip_reason"] = event.Reason
+	case events.TaskFinished:
+		if span := t.finish(event.Task, event); span != nil {
+			span.Error = event.Error
+		}
+	case events.ExecutorCreated:
+		if span, found := t.tasks[event.Task]; found {
+			span.Attributes["cogs.executor"] = event.Executor
+		}
+	case events.ExecutorStepStarted:
+		span := t.start(t.tasks[event.Task], event.Step, event.Time)
+		span.Attributes["cogs.task"] = event.Task
+		span.Attributes["cogs.executor"] = event.Executor
+		span.Attributes["cogs.step"] = event.Step
+		t.open[event.Task+"/"+event.Step] = span
+	case events.ExecutorStepFinished:
+		if span := t.finish(event.Task+"/"+event.Step, event); span != nil {
+			span.Error = event.Error
+		}
+	case events.PhaseStarted:
+		span := t.start(t.tasks[event.Task], event.Phase, event.Time)
+		span.Attributes["cogs.task"] = event.Task
+		span.Attributes["cogs.phase"] = event.Phase
+		t.open[event.Task+"/"+event.Phase] = span
+	case events.PhaseFinished:
+		span := t.finish(event.Task+"/"+event.Phase, event)
+
+		if span == nil {
+			return
+		}
+
+		span.Error = event.Error
+
+		if event.ExitCode != nil {
+			span.Attributes["cogs.exit_code"] = *event.ExitCode
+
+			if *event.ExitCode != 0 && span.Error == "" {
+				span.Error = fmt.Sprintf("exit code %d", *event.ExitCode)
+			}
+		}
+	}
+}
+
+func (t *Tracer) start(parent *Span, name string, start time.Time) *Span {
+	span := &Span{
+		TraceID:    t.traceID,
+		SpanID:     newID(8),
+		Name:       name,
+		Start:      start,
+		Attributes: map[string]interface{}{},
+	}
+
+	if parent != nil {
+		span.ParentID = parent.SpanID
+	}
+
+	t.spans = append(t.spans, span)
+
+	return span
+}
+
+func (t *Tracer) finish(key string, event events.Event) *Span {
+	span, found := t.open[key]
+
+	if !found {
+		return nil
+	}
+
+	span.End = event.Time
+	delete(t.open, key)
+
+	return span
+}
+
+// Spans returns the finished spans, in the order they started.
+func (t *Tracer) Spans() []Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	spans := make([]Span, 0, len(t.spans))
+
+	for _, span := range t.spans {
+		if span.End.IsZero() {
+			continue
+		}
+
+		copied := *span
+		copied.Attributes = make(map[string]interface{}, len(span.Attributes))
+
+		for key, value := range span.Attributes {
+			copied.Attributes[key] = value
+		}
+
+		spans = append(spans, copied)
+	}
+
+	return spans
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
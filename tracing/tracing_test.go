@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/kinematic-ci/cogs/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func trace() []Span {
+	start := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	tracer := NewTracer()
+
+	for _, event := range []events.Event{
+		{Type: events.RunStarted, Time: at(0), Run: "run-1", Target: "deploy"},
+		{Type: events.TaskSkipped, Time: at(0), Task: "build", Reason: "cached"},
+		{Type: events.TaskStarted, Time: at(1), Task: "deploy"},
+		{Type: events.ExecutorStepStarted, Time: at(1), Task: "deploy", Executor: "docker", Step: events.ImagePull},
+		{Type: events.ExecutorStepFinished, Time: at(3), Task: "deploy", Executor: "docker", Step: events.ImagePull},
+		{Type: events.ExecutorCreated, Time: at(4), Task: "deploy", Executor: "docker"},
+		{Type: events.PhaseStarted, Time: at(4), Task: "deploy", Phase: events.Script},
+		events.Event{Type: events.PhaseFinished, Time: at(9), Task: "deploy", Phase: events.Script}.WithExitCode(2),
+		{Type: events.PhaseStarted, Time: at(9), Task: "deploy", Phase: events.AfterScript},
+		{Type: events.TaskFinished, Time: at(10), Task: "deploy", Error: "script failed with exit code 2"},
+		{Type: events.RunFinished, Time: at(10), Error: "script failed with exit code 2"},
+	} {
+		tracer.Handle(event)
+	}
+
+	return tracer.Spans()
+}
+
+func TestTracer(t *testing.T) {
+	spans := trace()
+	require.Len(t, spans, 6)
+
+	run, build, deploy, pull, script, after := spans[0], spans[1], spans[2], spans[3], spans[4], spans[5]
+
+	t.Run("Should trace the run", func(t *testing.T) {
+		assert.Equal(t, "run deploy", run.Name)
+		assert.Equal(t, "", run.ParentID)
+		assert.Equal(t, 10*time.Second, run.End.Sub(run.Start))
+		assert.Equal(t, "script failed with exit code 2", run.Error)
+		assert.Equal(t, "run-1", run.Attributes["cogs.run.id"])
+
+		for _, span := range spans {
+			assert.Equal(t, run.TraceID, span.TraceID)
+			assert.Len(t, span.SpanID, 16)
+		}
+
+		assert.Len(t, run.TraceID, 32)
+	})
+
+	t.Run("Should trace tasks below the run", func(t *testing.T) {
+		assert.Equal(t, "build", build.Name)
+		assert.Equal(t, run.SpanID, build.ParentID)
+		assert.Equal(t, true, build.Attributes["cogs.skipped"])
+		assert.Equal(t, "cached", build.Attributes["cogs.skip_reason"])
+
+		assert.Equal(t, "deploy", deploy.Name)
+		assert.Equal(t, run.SpanID, deploy.ParentID)
+		assert.Equal(t, "docker", deploy.Attributes["cogs.executor"])
+		assert.Equal(t, 9*time.Second, deploy.End.Sub(deploy.Start))
+	})
+
+	t.Run("Should trace phases and executor steps below tasks", func(t *testing.T) {
+		assert.Equal(t, "image_pull", pull.Name)
+		assert.Equal(t, deploy.SpanID, pull.ParentID)
+		assert.Equal(t, 2*time.Second, pull.End.Sub(pull.Start))
+
+		assert.Equal(t, "script", script.Name)
+		assert.Equal(t, deploy.SpanID, script.ParentID)
+		assert.Equal(t, 2, script.Attributes["cogs.exit_code"])
+		assert.Equal(t, "exit code 2", script.Error)
+	})
+
+	t.Run("Should end spans left open when the run finishes", func(t *testing.T) {
+		assert.Equal(t, "after_script", after.Name)
+		assert.Equal(t, run.End, after.End)
+	})
+}
+
+func TestOTLP(t *testing.T) {
+	spans := trace()
+
+	t.Run("Should write spans as OTLP JSON", func(t *testing.T) {
+		var output bytes.Buffer
+		require.Nil(t, WriteOTLP(&output, spans))
+
+		var request otlpRequest
+		require.Nil(t, json.Unmarshal(output.Bytes(), &request))
+
+		encoded := request.ResourceSpans[0].ScopeSpans[0].Spans
+		require.Len(t, encoded, 6)
+
+		script := encoded[4]
+		assert.Equal(t, spans[4].SpanID, script.SpanID)
+		assert.Equal(t, spans[2].SpanID, script.ParentSpanID)
+		assert.Equal(t, "1593604804000000000", script.StartTimeUnixNano)
+		assert.Equal(t, otlpStatus{Code: statusError, Message: "exit code 2"}, script.Status)
+		assert.Equal(t, "cogs.exit_code", script.Attributes[0].Key)
+		assert.Equal(t, "2", *script.Attributes[0].Value.IntValue)
+		assert.Equal(t, otlpStatus{Code: statusOK}, encoded[1].Status)
+	})
+
+	t.Run("Should post spans to the traces endpoint", func(t *testing.T) {
+		var path, contentType string
+		var body []byte
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			contentType = r.Header.Get("Content-Type")
+			body, _ = ioutil.ReadAll(r.Body)
+		}))
+		defer server.Close()
+
+		require.Nil(t, ExportOTLP(context.Background(), server.URL, spans))
+
+		assert.Equal(t, "/v1/traces", path)
+		assert.Equal(t, "application/json", contentType)
+		assert.Contains(t, string(body), `"name":"run deploy"`)
+	})
+
+	t.Run("Should return error if the collector rejects spans", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		err := ExportOTLP(context.Background(), server.URL+"/v1/traces", spans)
+
+		assert.EqualError(t, err, "unable to export trace to "+server.URL+"/v1/traces: 404 Not Found")
+	})
+}
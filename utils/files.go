@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CopyTree copies a file or a directory tree from src to dst, keeping file
+// modes and symbolic links. Existing files in dst are overwritten.
+func CopyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			return copySymlink(path, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func copySymlink(src, dst string) error {
+	link, err := os.Readlink(src)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	_ = os.Remove(dst)
+
+	return os.Symlink(link, dst)
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	// Replace rather than truncate, the destination may be a hard link or a
+	// read-only file.
+	_ = os.Remove(dst)
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// ExpandHome replaces a leading ~/ in path with the home directory of the
+// current user.
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
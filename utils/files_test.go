@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cogs-copy")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "bin"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(src, "bin", "app"), []byte("app"), 0755))
+	require.Nil(t, os.Symlink("app", filepath.Join(src, "bin", "latest")))
+
+	dst := filepath.Join(dir, "dst")
+	require.Nil(t, os.MkdirAll(filepath.Join(dst, "bin"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dst, "bin", "app"), []byte("old"), 0444))
+
+	assert.Nil(t, CopyTree(src, dst))
+
+	content, err := ioutil.ReadFile(filepath.Join(dst, "bin", "app"))
+	assert.Nil(t, err)
+	assert.Equal(t, "app", string(content))
+
+	info, err := os.Stat(filepath.Join(dst, "bin", "app"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dst, "bin", "latest"))
+	assert.Nil(t, err)
+	assert.Equal(t, "app", link)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// GitCommit returns the commit checked out in dir, or nothing outside of git
+// repositories.
+func GitCommit(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// GitDirty reports whether the working tree in dir differs from the commit
+// checked out, untracked files included. Paths in exclude are not taken into
+// account. Outside of git repositories the working tree counts as dirty.
+func GitDirty(dir string, exclude ...string) bool {
+	args := []string{"status", "--porcelain", "--", "."}
+
+	for _, path := range exclude {
+		args = append(args, ":(exclude)"+path)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.Output()
+
+	return err != nil || len(output) > 0
+}
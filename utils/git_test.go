@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=cogs", "-c", "user.email=cogs@example.com"}, args...)...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	require.Nil(t, err, string(output))
+}
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "cogs-git")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Should return nothing outside of git repositories", func(t *testing.T) {
+		assert.Equal(t, "", GitCommit(dir))
+		assert.True(t, GitDirty(dir))
+	})
+
+	git(t, dir, "init", "-q")
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+	git(t, dir, "add", "main.go")
+	git(t, dir, "commit", "-q", "-m", "Initial commit")
+
+	t.Run("Should return the commit checked out", func(t *testing.T) {
+		assert.Len(t, GitCommit(dir), 40)
+		assert.False(t, GitDirty(dir))
+	})
+
+	t.Run("Should report changes and untracked files", func(t *testing.T) {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package app"), 0644))
+		assert.True(t, GitDirty(dir))
+
+		git(t, dir, "checkout", "-q", "main.go")
+		assert.False(t, GitDirty(dir))
+
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, ".cogs"), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".cogs", "state"), []byte("state"), 0644))
+		assert.True(t, GitDirty(dir))
+		assert.False(t, GitDirty(dir, ".cogs"))
+	})
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob returns the files below root matching any of the patterns, as sorted
+// slash separated paths relative to root. Patterns use path.Match syntax with
+// ** matching any number of directories. A pattern matching a directory
+// matches every file below it.
+func Glob(root string, patterns []string) ([]string, error) {
+	for _, pattern := range patterns {
+		_, err := path.Match(pattern, "")
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %s", pattern)
+		}
+	}
+
+	var files []string
+
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, file)
+
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if Match(patterns, rel) {
+			files = append(files, rel)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to search %s", root)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Match reports whether a slash separated relative path matches any of the
+// patterns, following the rules of Glob.
+func Match(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if matchFile(pattern, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchFile(pattern, file string) bool {
+	patternParts := strings.Split(path.Clean(pattern), "/")
+	fileParts := strings.Split(file, "/")
+
+	for i := len(fileParts); i > 0; i-- {
+		if matchParts(patternParts, fileParts[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	matched, _ := path.Match(pattern[0], parts[0])
+
+	return matched && matchParts(pattern[1:], parts[1:])
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	root, err := ioutil.TempDir("", "cogs-glob")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	for _, file := range []string{"go.mod", "main.go", "cli/run.go", "cli/run_test.go", "web/src/app/index.ts", "web/README.md"} {
+		require.Nil(t, os.MkdirAll(filepath.Join(root, filepath.Dir(file)), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(root, file), nil, 0644))
+	}
+
+	t.Run("Should match files in a single directory", func(t *testing.T) {
+		files, err := Glob(root, []string{"*.go", "go.mod"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"go.mod", "main.go"}, files)
+	})
+
+	t.Run("Should match any number of directories with **", func(t *testing.T) {
+		files, err := Glob(root, []string{"**/*.go"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"cli/run.go", "cli/run_test.go", "main.go"}, files)
+
+		files, err = Glob(root, []string{"web/**/*.ts"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"web/src/app/index.ts"}, files)
+	})
+
+	t.Run("Should match everything below a directory", func(t *testing.T) {
+		files, err := Glob(root, []string{"web"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"web/README.md", "web/src/app/index.ts"}, files)
+	})
+
+	t.Run("Should return error on invalid pattern", func(t *testing.T) {
+		_, err := Glob(root, []string{"[a"})
+
+		assert.NotNil(t, err)
+	})
+	t.Run("Should match single paths", func(t *testing.T) {
+		assert.True(t, Match([]string{"*.md", "web"}, "web/src/app/index.ts"))
+		assert.True(t, Match([]string{"**/*.go"}, "cli/run.go"))
+		assert.False(t, Match([]string{"**/*.go"}, "web/README.md"))
+	})
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LineWriter writes complete lines to w, each preceded by a prefix. Writers
+// sharing a mutex never interleave their lines.
+type LineWriter struct {
+	w      io.Writer
+	prefix []byte
+	mutex  *sync.Mutex
+	buffer []byte
+}
+
+func NewLineWriter(w io.Writer, prefix string, mutex *sync.Mutex) *LineWriter {
+	return &LineWriter{w: w, prefix: []byte(prefix), mutex: mutex}
+}
+
+func (l *LineWriter) Write(p []byte) (int, error) {
+	l.buffer = append(l.buffer, p...)
+	end := bytes.LastIndexByte(l.buffer, '\n')
+
+	if end < 0 {
+		return len(p), nil
+	}
+
+	err := l.writeLines(l.buffer[:end+1])
+	l.buffer = append(l.buffer[:0], l.buffer[end+1:]...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush writes an incomplete last line, terminating it.
+func (l *LineWriter) Flush() error {
+	if len(l.buffer) == 0 {
+		return nil
+	}
+
+	err := l.writeLines(append(l.buffer, '\n'))
+	l.buffer = l.buffer[:0]
+
+	return err
+}
+
+func (l *LineWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+
+	for len(lines) > 0 {
+		end := bytes.IndexByte(lines, '\n') + 1
+		out.Write(l.prefix)
+		out.Write(lines[:end])
+		lines = lines[end:]
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err := l.w.Write(out.Bytes())
+
+	return err
+}
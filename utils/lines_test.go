@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	t.Run("Should prefix complete lines", func(t *testing.T) {
+		var output bytes.Buffer
+		w := NewLineWriter(&output, "build | ", &sync.Mutex{})
+
+		_, err := w.Write([]byte("first\nsec"))
+		assert.Nil(t, err)
+		assert.Equal(t, "build | first\n", output.String())
+
+		_, err = w.Write([]byte("ond\nthird\nlast"))
+		assert.Nil(t, err)
+		assert.Equal(t, "build | first\nbuild | second\nbuild | third\n", output.String())
+
+		assert.Nil(t, w.Flush())
+		assert.Equal(t, "build | first\nbuild | second\nbuild | third\nbuild | last\n", output.String())
+	})
+}
@@ -1,5 +1,13 @@
 package utils
 
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+var unsafeShellChars = regexp.MustCompile(`[^\w@%+=:,./-]`)
+
 func StringOrDefault(str, defaultValue string) string {
 	if str != "" {
 		return str
@@ -7,3 +15,87 @@ func StringOrDefault(str, defaultValue string) string {
 
 	return defaultValue
 }
+
+// ShellQuote quotes a word for a POSIX shell, leaving it as is when no
+// quoting is needed.
+func ShellQuote(word string) string {
+	if word != "" && !unsafeShellChars.MatchString(word) {
+		return word
+	}
+
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// ShellJoin quotes and joins words into a single command line.
+func ShellJoin(words []string) string {
+	quoted := make([]string, len(words))
+
+	for i, word := range words {
+		quoted[i] = ShellQuote(word)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// SplitWords splits a command line into words the way a POSIX shell does,
+// honouring quotes and backslash escapes but without any expansion.
+func SplitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+					i++
+				}
+
+				word.WriteByte(line[i])
+			}
+
+			if i >= len(line) {
+				return nil, errors.New("unterminated double quote")
+			}
+
+			inWord = true
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+			}
+
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
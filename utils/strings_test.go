@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "./...", ShellQuote("./..."))
+	assert.Equal(t, "''", ShellQuote(""))
+	assert.Equal(t, "'hello world'", ShellQuote("hello world"))
+	assert.Equal(t, `'it'\''s'`, ShellQuote("it's"))
+	assert.Equal(t, "'$HOME'", ShellQuote("$HOME"))
+}
+
+func TestSplitWords(t *testing.T) {
+	t.Run("Should split on whitespace", func(t *testing.T) {
+		words, err := SplitWords("go  test\t./...")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"go", "test", "./..."}, words)
+	})
+
+	t.Run("Should honour quotes and escapes", func(t *testing.T) {
+		words, err := SplitWords(`echo 'a b' "c \"d\" $e" f\ g ''`)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"echo", "a b", `c "d" $e`, "f g", ""}, words)
+	})
+
+	t.Run("Should round trip quoted words", func(t *testing.T) {
+		argv := []string{"sh", "-c", "echo 'it works' && exit 1", ""}
+
+		words, err := SplitWords(ShellJoin(argv))
+
+		assert.Nil(t, err)
+		assert.Equal(t, argv, words)
+	})
+
+	t.Run("Should return error on unterminated quote", func(t *testing.T) {
+		_, err := SplitWords(`echo "oops`)
+
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,197 @@
+package watch
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/kinematic-ci/cogs/utils"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Watcher reports files changed below a directory. Changes are collected until
+// no file changed for the debounce interval and then reported together, as
+// sorted slash separated paths relative to the directory.
+type Watcher struct {
+	root     string
+	ignore   []string
+	debounce time.Duration
+	watcher  *fsnotify.Watcher
+	changes  chan []string
+	done     chan struct{}
+}
+
+// New watches root and every directory below it, apart from those matching
+// the ignore patterns. Patterns follow the rules of utils.Glob.
+func New(root string, ignore []string, debounce time.Duration) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create file watcher")
+	}
+
+	w := &Watcher{
+		root:     root,
+		ignore:   ignore,
+		debounce: debounce,
+		watcher:  watcher,
+		changes:  make(chan []string),
+		done:     make(chan struct{}),
+	}
+
+	_, err = w.addTree(root)
+
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Changes delivers the changed files.
+func (w *Watcher) Changes() <-chan []string {
+	return w.changes
+}
+
+func (w *Watcher) Close() error {
+	close(w.done)
+
+	err := w.watcher.Close()
+
+	if err != nil {
+		return errors.Wrap(err, "unable to close file watcher")
+	}
+
+	return nil
+}
+
+func (w *Watcher) run() {
+	pending := map[string]bool{}
+	var quiet <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			for _, file := range w.handle(event) {
+				pending[file] = true
+				quiet = time.After(w.debounce)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Println("Error watching files", err)
+		case <-quiet:
+			changed := make([]string, 0, len(pending))
+
+			for file := range pending {
+				changed = append(changed, file)
+			}
+
+			sort.Strings(changed)
+
+			select {
+			case w.changes <- changed:
+			case <-w.done:
+				return
+			}
+
+			pending = map[string]bool{}
+			quiet = nil
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// handle returns the files an event changed. Directories created after the
+// watcher started are watched too, along with the files they already hold.
+func (w *Watcher) handle(event fsnotify.Event) []string {
+	if event.Op == fsnotify.Chmod {
+		return nil
+	}
+
+	rel, ok := w.relative(event.Name)
+
+	if !ok {
+		return nil
+	}
+
+	if event.Op&fsnotify.Create != 0 {
+		info, err := os.Lstat(event.Name)
+
+		if err == nil && info.IsDir() {
+			files, err := w.addTree(event.Name)
+
+			if err != nil {
+				log.Println("Error watching files", err)
+			}
+
+			return files
+		}
+	}
+
+	return []string{rel}
+}
+
+func (w *Watcher) relative(file string) (string, bool) {
+	rel, err := filepath.Rel(w.root, file)
+
+	if err != nil || rel == "." {
+		return "", false
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	return rel, !utils.Match(w.ignore, rel)
+}
+
+// addTree watches dir and the directories below it, returning the files it
+// found.
+func (w *Watcher) addTree(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while walking.
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		rel, ok := w.relative(file)
+
+		if file != w.root && !ok {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.IsDir() {
+			files = append(files, rel)
+			return nil
+		}
+
+		return w.watcher.Add(file)
+	})
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to watch %s", dir)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,63 @@
+package watch
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	root, err := ioutil.TempDir("", "cogs-watch")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "src"), 0755))
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "out"), 0755))
+
+	w, err := New(root, []string{"out"}, 50*time.Millisecond)
+	require.Nil(t, err)
+	defer w.Close()
+
+	write := func(file string) {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(file)), []byte(file), 0644))
+	}
+
+	next := func() []string {
+		select {
+		case changed := <-w.Changes():
+			return changed
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	t.Run("Should report changes together", func(t *testing.T) {
+		write("src/main.go")
+		write("go.mod")
+		write("src/main.go")
+
+		assert.Equal(t, []string{"go.mod", "src/main.go"}, next())
+	})
+
+	t.Run("Should ignore matching files", func(t *testing.T) {
+		write("out/app")
+		write("README.md")
+
+		assert.Equal(t, []string{"README.md"}, next())
+	})
+
+	t.Run("Should watch new directories", func(t *testing.T) {
+		require.Nil(t, os.MkdirAll(filepath.Join(root, "src", "pkg"), 0755))
+		write("src/pkg/lib.go")
+
+		assert.Equal(t, []string{"src/pkg/lib.go"}, next())
+
+		write("src/pkg/lib.go")
+
+		assert.Equal(t, []string{"src/pkg/lib.go"}, next())
+	})
+}